@@ -17,6 +17,7 @@ package spacelog
 import (
 	"regexp"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
 	"text/template"
@@ -49,11 +50,32 @@ func callerName() string {
 
 // LoggerCollections contain all of the loggers a program might use. Typically
 // a codebase will just use the default logger collection.
+//
+// Logger names are hierarchical, with levels of the hierarchy separated by
+// dots. A logger without a level of its own (set with ConfigureLoggers or
+// SetLevel) inherits the level of its nearest ancestor that has one, or the
+// collection's default level, and follows that ancestor as it changes. For
+// example, after configuring "foo=debug", the loggers "foo.bar" and
+// "foo.bar.baz" are at debug too, whenever they are created.
+//
+// Levels may also be configured for glob patterns, where "*" matches any
+// sequence of characters, including dots. A logger's level is resolved by
+// checking, for the logger itself and then each of its ancestors in turn: a
+// level configured for that exact name, then the most recently configured
+// pattern that matches that name. If nothing matches, the collection's
+// default level is used.
 type LoggerCollection struct {
-	mtx     sync.Mutex
-	loggers map[string]*Logger
-	level   LogLevel
-	handler Handler
+	mtx      sync.Mutex
+	loggers  map[string]*Logger
+	levels   map[string]LogLevel
+	patterns []levelPattern
+	level    LogLevel
+	handler  Handler
+
+	overrides   []*LevelOverride
+	subscribers []*configSubscriber
+
+	extractors contextExtractors
 }
 
 // NewLoggerCollection creates a new logger collection. It's unlikely you will
@@ -61,6 +83,7 @@ type LoggerCollection struct {
 func NewLoggerCollection() *LoggerCollection {
 	return &LoggerCollection{
 		loggers: make(map[string]*Logger),
+		levels:  make(map[string]LogLevel),
 		level:   DefaultLevel,
 		handler: defaultHandler}
 }
@@ -72,14 +95,13 @@ func (c *LoggerCollection) GetLogger() *Logger {
 	return c.GetLoggerNamed(callerName())
 }
 
-func (c *LoggerCollection) getLogger(name string, level LogLevel,
-	handler Handler) *Logger {
+func (c *LoggerCollection) getLogger(name string, handler Handler) *Logger {
 	c.mtx.Lock()
 	defer c.mtx.Unlock()
 
 	logger, exists := c.loggers[name]
 	if !exists {
-		logger = &Logger{level: level,
+		logger = &Logger{level: c.effectiveLevel(name),
 			collection: c,
 			name:       name,
 			handler:    handler}
@@ -88,33 +110,248 @@ func (c *LoggerCollection) getLogger(name string, level LogLevel,
 	return logger
 }
 
+// levelPattern is a level configured for every logger whose name matches a
+// glob pattern.
+type levelPattern struct {
+	pattern string
+	level   LogLevel
+}
+
+// isLevelPattern returns true if name is a glob pattern rather than a logger
+// name.
+func isLevelPattern(name string) bool {
+	return strings.Contains(name, "*")
+}
+
+// matchLevelPattern reports whether name matches pattern, where "*" matches
+// any sequence of characters.
+func matchLevelPattern(pattern, name string) bool {
+	star := strings.IndexByte(pattern, '*')
+	if star < 0 {
+		return pattern == name
+	}
+	if !strings.HasPrefix(name, pattern[:star]) {
+		return false
+	}
+	rest := pattern[star+1:]
+	for i := star; i <= len(name); i++ {
+		if matchLevelPattern(rest, name[i:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// configuredLevel returns the level configured for exactly the named logger,
+// either by name or by the most recently configured matching pattern.
+// c.mtx must be held.
+func (c *LoggerCollection) configuredLevel(name string) (LogLevel, bool) {
+	if level, exists := c.levels[name]; exists {
+		return level, true
+	}
+	for i := len(c.patterns) - 1; i >= 0; i-- {
+		if matchLevelPattern(c.patterns[i].pattern, name) {
+			return c.patterns[i].level, true
+		}
+	}
+	return 0, false
+}
+
+// effectiveLevel returns the level configured for the named logger or its
+// nearest configured ancestor, or the collection's default level if there is
+// none. c.mtx must be held.
+func (c *LoggerCollection) effectiveLevel(name string) LogLevel {
+	level := c.configuredOrInheritedLevel(name)
+	if override, exists := c.overrideLevel(name); exists && override < level {
+		return override
+	}
+	return level
+}
+
+func (c *LoggerCollection) configuredOrInheritedLevel(name string) LogLevel {
+	for {
+		if level, exists := c.configuredLevel(name); exists {
+			return level
+		}
+		i := strings.LastIndex(name, ".")
+		if i < 0 {
+			return c.level
+		}
+		name = name[:i]
+	}
+}
+
+// changeLevels runs fn, which changes the configured levels, with c.mtx
+// held. It then re-evaluates the level of every logger and notifies
+// subscribers of every level that changed as a result.
+func (c *LoggerCollection) changeLevels(source string, fn func()) {
+	c.mtx.Lock()
+	old_default := c.level
+	fn()
+	var changes []ConfigChange
+	if c.level != old_default {
+		changes = append(changes, ConfigChange{
+			Kind:     LevelChange,
+			Logger:   "DEFAULT",
+			OldLevel: old_default,
+			NewLevel: c.level,
+			Source:   source})
+	}
+	for name, logger := range c.loggers {
+		old_level, new_level := logger.getLevel(), c.effectiveLevel(name)
+		if old_level == new_level {
+			continue
+		}
+		logger.setLevel(new_level)
+		changes = append(changes, ConfigChange{
+			Kind:     LevelChange,
+			Logger:   name,
+			OldLevel: old_level,
+			NewLevel: new_level,
+			Source:   source})
+	}
+	subscribers := c.subscribers
+	c.mtx.Unlock()
+	notifySubscribers(subscribers, changes)
+}
+
 // ConfigureLoggers configures loggers according to the given string
 // specification, which specifies a set of loggers and their associated
-// logging levels.  Loggers are semicolon-separated; each
+// logging levels.  Loggers are semicolon-, comma- or newline-separated; each
 // configuration is specified as <logger>=<level>.  White space outside of
-// logger names and levels is ignored.  The default level is specified
-// with the name "DEFAULT".
+// logger names and levels is ignored, as are empty entries and comments
+// starting with "#".  The default level is specified with the name
+// "DEFAULT". Configuring a logger also configures its descendants that have
+// no level of their own, including ones created later. A logger name
+// containing "*" is a glob pattern, and configures every logger that matches
+// it, including ones created later. See LoggerCollection for how conflicting
+// configuration is resolved.
+//
+// The whole specification is parsed before any of it is applied, so if any
+// entry is malformed, a *SpecificationError is returned and no logger is
+// changed.
 //
 // An example specification:
-//	`DEFAULT=ERROR; foo.bar=WARNING`
+//	`DEFAULT=ERROR; foo.bar=WARNING; storage.*=DEBUG; *.rpc=TRACE`
 func (c *LoggerCollection) ConfigureLoggers(specification string) error {
-	confs := strings.Split(strings.TrimSpace(specification), ";")
-	for i := range confs {
-		conf := strings.SplitN(confs[i], "=", 2)
-		levelstr := strings.TrimSpace(conf[1])
-		name := strings.TrimSpace(conf[0])
-		level, err := LevelFromString(levelstr)
-		if err != nil {
-			return err
+	specs, err := ParseSpecification(specification)
+	if err != nil {
+		return err
+	}
+	c.applyLevelSpecs(specs, "ConfigureLoggers")
+	return nil
+}
+
+// applyLevelSpecs applies the given specs in order, as a single change.
+func (c *LoggerCollection) applyLevelSpecs(specs []LevelSpec, source string) {
+	c.changeLevels(source, func() {
+		c.applyLevelSpecsLocked(specs)
+	})
+}
+
+func (c *LoggerCollection) applyLevelSpecsLocked(specs []LevelSpec) {
+	for _, spec := range specs {
+		switch {
+		case spec.Name == "DEFAULT":
+			c.level = spec.Level
+			c.levels = make(map[string]LogLevel)
+			c.patterns = nil
+		case isLevelPattern(spec.Name):
+			// a reconfigured pattern moves to the end, as the most recent
+			for i, pattern := range c.patterns {
+				if pattern.pattern == spec.Name {
+					c.patterns = append(c.patterns[:i:i], c.patterns[i+1:]...)
+					break
+				}
+			}
+			c.patterns = append(c.patterns, levelPattern{
+				pattern: spec.Name, level: spec.Level})
+		default:
+			c.levels[spec.Name] = spec.Level
 		}
-		if name == "DEFAULT" {
-			c.SetLevel(nil, level)
-			continue
+	}
+}
+
+// LoggerInfo describes a logger in a LoggerCollection.
+type LoggerInfo struct {
+	Name    string
+	Level   LogLevel
+	Handler Handler
+
+	// Inherited is true if no level is configured for the logger by name or
+	// by a matching pattern, and Level comes from an ancestor or the
+	// collection's default level.
+	Inherited bool
+}
+
+// Loggers returns information about every logger in the collection, sorted
+// by name.
+func (c *LoggerCollection) Loggers() []LoggerInfo {
+	c.mtx.Lock()
+	infos := make([]LoggerInfo, 0, len(c.loggers))
+	for name, logger := range c.loggers {
+		_, configured := c.configuredLevel(name)
+		infos = append(infos, LoggerInfo{
+			Name:      name,
+			Level:     logger.getLevel(),
+			Handler:   logger.getHandler(),
+			Inherited: !configured})
+	}
+	c.mtx.Unlock()
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
+
+// Each calls fn for every logger in the collection, in name order, until fn
+// returns false. fn is called with a snapshot of the collection, so it may
+// safely call other LoggerCollection methods.
+func (c *LoggerCollection) Each(fn func(info LoggerInfo) bool) {
+	for _, info := range c.Loggers() {
+		if !fn(info) {
+			return
 		}
-		logger := c.GetLoggerNamed(name)
-		logger.setLevel(level)
 	}
-	return nil
+}
+
+// Level returns the current level of the named logger, and whether the
+// logger exists. The name "DEFAULT" returns the collection's default level.
+func (c *LoggerCollection) Level(name string) (level LogLevel, exists bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if name == "DEFAULT" {
+		return c.level, true
+	}
+	logger, exists := c.loggers[name]
+	if !exists {
+		return 0, false
+	}
+	return logger.getLevel(), true
+}
+
+// Specification returns the collection's current configuration as a
+// specification that ConfigureLoggers accepts, listing the default level,
+// every configured logger level in name order, and then every configured
+// pattern in the order it applies. Loggers that inherit their level are left
+// out.
+func (c *LoggerCollection) Specification() string {
+	c.mtx.Lock()
+	names := make([]string, 0, len(c.levels))
+	for name := range c.levels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	entries := []string{"DEFAULT=" + c.level.specString()}
+	for _, name := range names {
+		entries = append(entries, name+"="+c.levels[name].specString())
+	}
+	for _, pattern := range c.patterns {
+		entries = append(entries,
+			pattern.pattern+"="+pattern.level.specString())
+	}
+	c.mtx.Unlock()
+	return strings.Join(entries, "; ")
 }
 
 // GetLoggerNamed returns a new Logger with the provided name. GetLogger is
@@ -125,7 +362,7 @@ func (c *LoggerCollection) GetLoggerNamed(name string) *Logger {
 
 	logger, exists := c.loggers[name]
 	if !exists {
-		logger = &Logger{level: c.level,
+		logger = &Logger{level: c.effectiveLevel(name),
 			collection: c,
 			name:       name,
 			handler:    c.handler}
@@ -135,20 +372,23 @@ func (c *LoggerCollection) GetLoggerNamed(name string) *Logger {
 }
 
 // SetLevel will set the current log level for all loggers with names that
-// match a provided regular expression. If the regular expression is nil, then
-// all loggers match.
+// match a provided regular expression, and their descendants that have no
+// level of their own. If the regular expression is nil, then all loggers
+// match, and the default level is set, and any levels configured for
+// individual loggers or patterns are cleared.
 func (c *LoggerCollection) SetLevel(re *regexp.Regexp, level LogLevel) {
-	c.mtx.Lock()
-	defer c.mtx.Unlock()
-
-	if re == nil {
-		c.level = level
-	}
-	for name, logger := range c.loggers {
-		if re == nil || re.MatchString(name) {
-			logger.setLevel(level)
+	c.changeLevels("SetLevel", func() {
+		if re == nil {
+			c.level = level
+			c.levels = make(map[string]LogLevel)
+			c.patterns = nil
 		}
-	}
+		for name := range c.loggers {
+			if re != nil && re.MatchString(name) {
+				c.levels[name] = level
+			}
+		}
+	})
 }
 
 // SetHandler will set the current log handler for all loggers with names that
@@ -156,16 +396,34 @@ func (c *LoggerCollection) SetLevel(re *regexp.Regexp, level LogLevel) {
 // all loggers match.
 func (c *LoggerCollection) SetHandler(re *regexp.Regexp, handler Handler) {
 	c.mtx.Lock()
-	defer c.mtx.Unlock()
-
+	var changes []ConfigChange
 	if re == nil {
+		changes = append(changes, ConfigChange{
+			Kind:       HandlerChange,
+			Logger:     "DEFAULT",
+			OldLevel:   c.level,
+			NewLevel:   c.level,
+			OldHandler: c.handler,
+			NewHandler: handler,
+			Source:     "SetHandler"})
 		c.handler = handler
 	}
 	for name, logger := range c.loggers {
 		if re == nil || re.MatchString(name) {
+			changes = append(changes, ConfigChange{
+				Kind:       HandlerChange,
+				Logger:     name,
+				OldLevel:   logger.getLevel(),
+				NewLevel:   logger.getLevel(),
+				OldHandler: logger.getHandler(),
+				NewHandler: handler,
+				Source:     "SetHandler"})
 			logger.setHandler(handler)
 		}
 	}
+	subscribers := c.subscribers
+	c.mtx.Unlock()
+	notifySubscribers(subscribers, changes)
 }
 
 // SetTextTemplate will set the current text template for all loggers with
@@ -225,19 +483,37 @@ func GetLoggerNamed(name string) *Logger {
 	return DefaultLoggerCollection.GetLoggerNamed(name)
 }
 
-// ConfigureLoggers configures loggers according to the given string
-// specification, which specifies a set of loggers and their associated
-// logging levels.  Loggers are colon- or semicolon-separated; each
-// configuration is specified as <logger>=<level>.  White space outside of
-// logger names and levels is ignored.  The DEFAULT module is specified
-// with the name "DEFAULT".
+// ConfigureLoggers configures loggers on the default logger collection
+// according to the given string specification, which specifies a set of
+// loggers and their associated logging levels.  Loggers are semicolon-,
+// comma- or newline-separated; each configuration is specified as
+// <logger>=<level>.  White space outside of logger names and levels is
+// ignored, as are empty entries and comments starting with "#".  The default
+// level is specified with the name "DEFAULT". A logger name containing "*"
+// is a glob pattern.
+//
+// The whole specification is parsed before any of it is applied, so if any
+// entry is malformed, a *SpecificationError is returned and no logger is
+// changed.
 //
 // An example specification:
-//	`DEFAULT=ERROR; foo.bar=WARNING`
+//	`DEFAULT=ERROR; foo.bar=WARNING; storage.*=DEBUG; *.rpc=TRACE`
 func ConfigureLoggers(specification string) error {
 	return DefaultLoggerCollection.ConfigureLoggers(specification)
 }
 
+// Loggers returns information about every logger in the default logger
+// collection, sorted by name.
+func Loggers() []LoggerInfo {
+	return DefaultLoggerCollection.Loggers()
+}
+
+// Specification returns the default logger collection's current
+// configuration as a specification that ConfigureLoggers accepts.
+func Specification() string {
+	return DefaultLoggerCollection.Specification()
+}
+
 // SetLevel will set the current log level for all loggers on the default
 // collection with names that match a provided regular expression. If the
 // regular expression is nil, then all loggers match.
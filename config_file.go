@@ -0,0 +1,675 @@
+// Copyright (C) 2017 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spacelog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// readSetupFile reads a JSON configuration file, or a .toml file in the
+// restricted syntax parseKeyValues describes, and returns base with the
+// settings from the file applied on top. Keys name SetupConfig fields, ignoring case, underscores and dashes.
+// A "loggers" object or table maps logger names or patterns to levels, as in
+// ConfigureLoggers, and those are returned separately, in the order the file
+// lists them. The file's contents are returned too, so that changes to it
+// can be detected.
+func readSetupFile(path string, base SetupConfig) (
+	config SetupConfig, loggers []LevelSpec, data []byte, err error) {
+	data, err = ioutil.ReadFile(path)
+	if err != nil {
+		return config, nil, nil, err
+	}
+	var values *setupTable
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		values, err = parseSetupJSON(data)
+	case ".toml":
+		values, err = parseKeyValues(data)
+	default:
+		err = fmt.Errorf("unknown configuration file type %q; expected "+
+			".json or .toml", filepath.Ext(path))
+	}
+	if err != nil {
+		return config, nil, nil, fmt.Errorf("%s: %s", path, err)
+	}
+	config, loggers, err = applySetupValues(base, values)
+	if err != nil {
+		return config, nil, nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return config, loggers, data, nil
+}
+
+// setupFileWatcher reapplies a Setup configuration file when its contents
+// change. Only level and format changes are applied; other settings, such as
+// the outputs, take effect at the next Setup.
+type setupFileWatcher struct {
+	base    SetupConfig
+	outputs []*setupOutput
+	sigchan chan os.Signal
+	stop    chan struct{}
+	done    chan struct{}
+
+	mtx    sync.Mutex
+	mtime  time.Time
+	data   []byte
+	format string
+}
+
+var (
+	setup_watcher_mtx sync.Mutex
+	setup_watcher     *setupFileWatcher
+)
+
+// watchSetupFile starts checking base.ConfigFile for changes every
+// config.ConfigPoll when its modification time changes, and whenever the
+// process gets a HUP signal. config and data are the configuration Setup
+// applied from the file and the file contents it was read from. Any earlier
+// watcher is stopped.
+func watchSetupFile(base, config SetupConfig, data []byte,
+	outputs []*setupOutput) error {
+	poll := 5 * time.Second
+	if config.ConfigPoll != "" {
+		var err error
+		poll, err = time.ParseDuration(config.ConfigPoll)
+		if err != nil {
+			return err
+		}
+	}
+	w := &setupFileWatcher{
+		base:    base,
+		outputs: outputs,
+		sigchan: make(chan os.Signal, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+		data:    data,
+		format:  config.Format}
+	if fi, err := os.Stat(base.ConfigFile); err == nil {
+		w.mtime = fi.ModTime()
+	}
+	setup_watcher_mtx.Lock()
+	defer setup_watcher_mtx.Unlock()
+	if setup_watcher != nil {
+		setup_watcher.close()
+	}
+	setup_watcher = w
+	signal.Notify(w.sigchan, sigHUP)
+	go w.run(poll)
+	return nil
+}
+
+// stopSetupFileWatcher stops the watcher started by the last Setup, if any.
+func stopSetupFileWatcher() {
+	setup_watcher_mtx.Lock()
+	defer setup_watcher_mtx.Unlock()
+	if setup_watcher != nil {
+		setup_watcher.close()
+		setup_watcher = nil
+	}
+}
+
+func (w *setupFileWatcher) run(poll time.Duration) {
+	defer close(w.done)
+	var tick <-chan time.Time
+	if poll > 0 {
+		ticker := time.NewTicker(poll)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-w.sigchan:
+			w.reload()
+		case <-tick:
+			w.poll()
+		}
+	}
+}
+
+// close stops the watcher and waits for any reload in progress to finish.
+func (w *setupFileWatcher) close() {
+	signal.Stop(w.sigchan)
+	close(w.stop)
+	<-w.done
+}
+
+func (w *setupFileWatcher) poll() {
+	fi, err := os.Stat(w.base.ConfigFile)
+	if err != nil {
+		return
+	}
+	w.mtx.Lock()
+	changed := !fi.ModTime().Equal(w.mtime)
+	w.mtx.Unlock()
+	if changed {
+		w.reload()
+	}
+}
+
+// reload reapplies the file if its contents have changed since they were
+// last applied. Levels set since then by other means, such as
+// ConfigureLoggers, are kept if the file hasn't changed.
+func (w *setupFileWatcher) reload() {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	logger := GetLoggerNamed("spacelog.config")
+	path := w.base.ConfigFile
+	if fi, err := os.Stat(path); err == nil {
+		w.mtime = fi.ModTime()
+	}
+	config, loggers, data, err := readSetupFile(path, w.base)
+	if err == nil && bytes.Equal(data, w.data) {
+		return
+	}
+	if err == nil && config.Format != w.format {
+		var handler Handler
+		handler, err = newSetupHandler(w.outputs, config.Format)
+		if err == nil {
+			SetHandler(nil, handler)
+			w.format = config.Format
+		}
+	}
+	if err == nil {
+		err = setupLevels(config, loggers, "file "+path, true)
+	}
+	if err != nil {
+		logger.Errorf("reloading %s failed: %s", path, err)
+		return
+	}
+	w.data = data
+	logger.Noticef("reloaded %s", path)
+}
+
+// setupTable holds the settings from a configuration file, or one of its
+// tables. Unlike a map, it keeps the order keys were first given in, since
+// later logger patterns take precedence over earlier ones.
+type setupTable struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func newSetupTable() *setupTable {
+	return &setupTable{values: make(map[string]interface{})}
+}
+
+func (t *setupTable) set(key string, value interface{}) {
+	if _, exists := t.values[key]; !exists {
+		t.keys = append(t.keys, key)
+	}
+	t.values[key] = value
+}
+
+// parseSetupJSON parses a JSON object, keeping the order of the keys in it
+// and in any objects nested in it.
+func parseSetupJSON(data []byte) (*setupTable, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	value, err := decodeJSONValue(dec)
+	if err != nil {
+		return nil, err
+	}
+	table, ok := value.(*setupTable)
+	if !ok {
+		return nil, fmt.Errorf("expected a JSON object")
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after JSON object")
+	}
+	return table, nil
+}
+
+// decodeJSONValue decodes the next value from dec as json.Unmarshal would
+// into an interface{}, except that objects become ordered setupTables.
+func decodeJSONValue(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case json.Delim('{'):
+		table := newSetupTable()
+		for dec.More() {
+			tok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeJSONValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			table.set(tok.(string), value)
+		}
+		_, err = dec.Token()
+		return table, err
+	case json.Delim('['):
+		var list []interface{}
+		for dec.More() {
+			value, err := decodeJSONValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		_, err = dec.Token()
+		return list, err
+	}
+	return tok, nil
+}
+
+func normalizeSetupKey(key string) string {
+	return strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(key))
+}
+
+// applySetupValues sets the fields of config named by values.
+func applySetupValues(config SetupConfig, values *setupTable) (
+	SetupConfig, []LevelSpec, error) {
+	fields := make(map[string]reflect.Value)
+	v := reflect.ValueOf(&config).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		fields[normalizeSetupKey(v.Type().Field(i).Name)] = v.Field(i)
+	}
+	delete(fields, "configfile")
+
+	var loggers []LevelSpec
+	for _, key := range values.keys {
+		value := values.values[key]
+		if normalizeSetupKey(key) == "loggers" {
+			levels, ok := value.(*setupTable)
+			if !ok {
+				return config, nil, fmt.Errorf("loggers must be an object")
+			}
+			for _, name := range levels.keys {
+				levelval := levels.values[name]
+				levelstr, ok := levelval.(string)
+				if !ok {
+					levelstr = fmt.Sprint(levelval)
+				}
+				level, err := LevelFromString(levelstr)
+				if err != nil {
+					return config, nil, fmt.Errorf("logger %q: %s", name, err)
+				}
+				loggers = append(loggers, LevelSpec{Name: name, Level: level})
+			}
+			continue
+		}
+		field, ok := fields[normalizeSetupKey(key)]
+		if !ok {
+			return config, nil, fmt.Errorf("unknown setting %q", key)
+		}
+		err := setSetupField(field, value)
+		if err != nil {
+			return config, nil, fmt.Errorf("setting %q: %s", key, err)
+		}
+	}
+	return config, loggers, nil
+}
+
+// setSetupField sets a string, integer or boolean SetupConfig field from a
+// decoded JSON or .toml file value, or from a string.
+func setSetupField(field reflect.Value, value interface{}) error {
+	switch field.Kind() {
+	case reflect.String:
+		switch value := value.(type) {
+		case string:
+			field.SetString(value)
+		case float64, int64, bool:
+			field.SetString(fmt.Sprint(value))
+		default:
+			return fmt.Errorf("expected a string")
+		}
+	case reflect.Int, reflect.Int64:
+		switch value := value.(type) {
+		case float64:
+			if value != float64(int64(value)) {
+				return fmt.Errorf("expected an integer")
+			}
+			field.SetInt(int64(value))
+		case int64:
+			field.SetInt(value)
+		case string:
+			i, err := strconv.ParseInt(value, 0, 64)
+			if err != nil {
+				return err
+			}
+			field.SetInt(i)
+		default:
+			return fmt.Errorf("expected an integer")
+		}
+	case reflect.Bool:
+		switch value := value.(type) {
+		case bool:
+			field.SetBool(value)
+		case string:
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return err
+			}
+			field.SetBool(b)
+		default:
+			return fmt.Errorf("expected a boolean")
+		}
+	default:
+		return fmt.Errorf("unsupported setting type %s", field.Type())
+	}
+	return nil
+}
+
+// parseKeyValues parses .toml configuration files. It isn't a TOML parser;
+// it reads only a restricted, TOML-like syntax that is enough for settings:
+//
+//	# comments
+//	key = "string", 'literal string', 123 or true
+//	key = { inline = "table", of = 1, settings = false }
+//	[table]
+//
+// Keys may be bare or quoted. At the top level, a dotted key such as
+// loggers."foo.bar" sets a key in a table. Inside a table, dotted keys are
+// kept whole, as are dotted table names, so foo.bar = "debug" in a [loggers]
+// table names the foo.bar logger. Anything else, such as arrays, floats,
+// dates, multi-line strings or nested tables, is an error.
+func parseKeyValues(data []byte) (*setupTable, error) {
+	values := newSetupTable()
+	table := values
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		var err error
+		if line[0] == '[' {
+			table, err = parseKVHeader(values, line)
+		} else {
+			err = parseKVLine(values, table, line)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineno, err)
+		}
+	}
+	return values, scanner.Err()
+}
+
+// parseKVHeader parses a [table] header line, returning the table.
+func parseKVHeader(values *setupTable, line string) (*setupTable, error) {
+	if strings.HasPrefix(line, "[[") {
+		return nil, fmt.Errorf("arrays of tables are not supported")
+	}
+	end := kvIndex(line, ']')
+	if end < 0 || strings.TrimSpace(stripKVComment(line[end+1:])) != "" {
+		return nil, fmt.Errorf("invalid table header")
+	}
+	parts, err := parseKVKey(strings.TrimSpace(line[1:end]))
+	if err != nil {
+		return nil, err
+	}
+	return kvTable(values, strings.Join(parts, "."))
+}
+
+// parseKVLine parses a key = value line into table, or into a table of
+// values if the key is dotted and table is values itself.
+func parseKVLine(values, table *setupTable, line string) error {
+	eq := kvIndex(line, '=')
+	if eq < 0 {
+		return fmt.Errorf("expected key = value")
+	}
+	parts, err := parseKVKey(strings.TrimSpace(line[:eq]))
+	if err != nil {
+		return err
+	}
+	value, err := parseKVValue(strings.TrimSpace(line[eq+1:]), true)
+	if err != nil {
+		return err
+	}
+	if table == values && len(parts) > 1 {
+		table, err = kvTable(values, parts[0])
+		if err != nil {
+			return err
+		}
+		parts = parts[1:]
+	}
+	return kvSet(table, strings.Join(parts, "."), value)
+}
+
+// kvTable returns the table named name in values, adding it if need be.
+func kvTable(values *setupTable, name string) (*setupTable, error) {
+	value, exists := values.values[name]
+	if !exists {
+		table := newSetupTable()
+		values.set(name, table)
+		return table, nil
+	}
+	table, ok := value.(*setupTable)
+	if !ok {
+		return nil, fmt.Errorf("%q is not a table", name)
+	}
+	return table, nil
+}
+
+func kvSet(table *setupTable, key string, value interface{}) error {
+	if _, exists := table.values[key]; exists {
+		return fmt.Errorf("duplicate key %q", key)
+	}
+	table.set(key, value)
+	return nil
+}
+
+// kvIndex returns the index of the first c in s that isn't inside a quoted
+// string, or -1 if there is none.
+func kvIndex(s string, c byte) int {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		switch {
+		case quote != 0:
+			if s[i] == '\\' && quote == '"' {
+				i++
+			} else if s[i] == quote {
+				quote = 0
+			}
+		case s[i] == '"' || s[i] == '\'':
+			quote = s[i]
+		case s[i] == c:
+			return i
+		}
+	}
+	return -1
+}
+
+// parseKVKey parses a bare or quoted key, or a dotted combination of them,
+// returning its parts.
+func parseKVKey(key string) ([]string, error) {
+	if key == "" {
+		return nil, fmt.Errorf("missing key")
+	}
+	var parts []string
+	rest := key
+	for {
+		rest = strings.TrimSpace(rest)
+		if rest == "" {
+			return nil, fmt.Errorf("invalid key %q", key)
+		}
+		var part string
+		if rest[0] == '"' || rest[0] == '\'' {
+			var err error
+			part, rest, err = parseKVString(rest)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			end := strings.IndexByte(rest, '.')
+			if end < 0 {
+				end = len(rest)
+			}
+			part, rest = strings.TrimSpace(rest[:end]), rest[end:]
+			if part == "" {
+				return nil, fmt.Errorf("invalid key %q", key)
+			}
+			for _, r := range part {
+				if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' ||
+					r >= '0' && r <= '9' || r == '_' || r == '-') {
+					return nil, fmt.Errorf("invalid key %q", key)
+				}
+			}
+		}
+		parts = append(parts, part)
+		rest = strings.TrimSpace(rest)
+		if rest == "" {
+			return parts, nil
+		}
+		if rest[0] != '.' {
+			return nil, fmt.Errorf("invalid key %q", key)
+		}
+		rest = rest[1:]
+	}
+}
+
+// parseKVValue parses a string, integer or boolean value, or an inline table
+// of them if inline is true, followed by an optional comment.
+func parseKVValue(value string, inline bool) (interface{}, error) {
+	if value == "" {
+		return nil, fmt.Errorf("missing value")
+	}
+	switch {
+	case strings.HasPrefix(value, `"""`) || strings.HasPrefix(value, "'''"):
+		return nil, fmt.Errorf("multi-line strings are not supported")
+	case value[0] == '"' || value[0] == '\'':
+		s, rest, err := parseKVString(value)
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(stripKVComment(rest)) != "" {
+			return nil, fmt.Errorf("unexpected %q after string",
+				strings.TrimSpace(rest))
+		}
+		return s, nil
+	case value[0] == '{' && inline:
+		return parseKVInlineTable(value)
+	case value[0] == '{':
+		return nil, fmt.Errorf("nested inline tables are not supported")
+	case value[0] == '[':
+		return nil, fmt.Errorf("arrays are not supported")
+	}
+	value = strings.TrimSpace(stripKVComment(value))
+	switch value {
+	case "":
+		return nil, fmt.Errorf("missing value")
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	number := strings.Replace(value, "_", "", -1)
+	// unlike Go, TOML has no octal integers with just a leading zero
+	digits := strings.TrimLeft(number, "+-")
+	if len(digits) > 1 && digits[0] == '0' && digits[1] >= '0' &&
+		digits[1] <= '9' {
+		return nil, fmt.Errorf("invalid integer %q", value)
+	}
+	i, err := strconv.ParseInt(number, 0, 64)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported value %q; expected a string, "+
+			"integer, boolean or inline table", value)
+	}
+	return i, nil
+}
+
+// parseKVInlineTable parses a one-line { key = value, ... } table.
+func parseKVInlineTable(value string) (*setupTable, error) {
+	end := kvIndex(value, '}')
+	if end < 0 {
+		return nil, fmt.Errorf("unterminated inline table")
+	}
+	if nested := kvIndex(value[1:], '{'); nested >= 0 && nested < end {
+		return nil, fmt.Errorf("nested inline tables are not supported")
+	}
+	if rest := strings.TrimSpace(stripKVComment(value[end+1:])); rest != "" {
+		return nil, fmt.Errorf("unexpected %q after inline table", rest)
+	}
+	table := newSetupTable()
+	entries := strings.TrimSpace(value[1:end])
+	for entries != "" {
+		entry := entries
+		entries = ""
+		if comma := kvIndex(entry, ','); comma >= 0 {
+			entry, entries = entry[:comma], strings.TrimSpace(entry[comma+1:])
+			if entries == "" {
+				return nil, fmt.Errorf("trailing comma in inline table")
+			}
+		}
+		eq := kvIndex(entry, '=')
+		if eq < 0 {
+			return nil, fmt.Errorf("expected key = value in inline table")
+		}
+		parts, err := parseKVKey(strings.TrimSpace(entry[:eq]))
+		if err != nil {
+			return nil, err
+		}
+		value, err := parseKVValue(strings.TrimSpace(entry[eq+1:]), false)
+		if err != nil {
+			return nil, err
+		}
+		err = kvSet(table, strings.Join(parts, "."), value)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return table, nil
+}
+
+// parseKVString parses a basic ("...") or literal ('...') string at the
+// start of s, returning it and the remainder of s.
+func parseKVString(s string) (value, rest string, err error) {
+	if s[0] == '\'' {
+		end := strings.IndexByte(s[1:], '\'')
+		if end < 0 {
+			return "", "", fmt.Errorf("unterminated string")
+		}
+		return s[1 : end+1], s[end+2:], nil
+	}
+	for end := 1; end < len(s); end++ {
+		switch s[end] {
+		case '\\':
+			end++
+		case '"':
+			value, err = strconv.Unquote(s[:end+1])
+			if err != nil {
+				return "", "", fmt.Errorf("invalid string %s", s[:end+1])
+			}
+			return value, s[end+1:], nil
+		}
+	}
+	return "", "", fmt.Errorf("unterminated string")
+}
+
+// stripKVComment removes a trailing comment from s, which must not contain
+// any strings.
+func stripKVComment(s string) string {
+	if i := strings.IndexByte(s, '#'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
@@ -0,0 +1,223 @@
+// Copyright (C) 2017 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spacelog
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// formatSetupTable renders table in key order, with the types of values
+// other than strings and tables, for comparing in tests.
+func formatSetupTable(table *setupTable) string {
+	parts := make([]string, 0, len(table.keys))
+	for _, key := range table.keys {
+		var value string
+		switch v := table.values[key].(type) {
+		case *setupTable:
+			value = formatSetupTable(v)
+		case string:
+			value = strconv.Quote(v)
+		default:
+			value = fmt.Sprintf("%T(%v)", v, v)
+		}
+		parts = append(parts, strconv.Quote(key)+"="+value)
+	}
+	return "{" + strings.Join(parts, " ") + "}"
+}
+
+func TestParseKeyValues(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		input  string
+		values string
+	}{
+		{name: "empty", input: "", values: `{}`},
+		{name: "comments and blank lines",
+			input:  "# a comment\n\n   # indented comment\n\r\n",
+			values: `{}`},
+		{name: "scalars",
+			input: "level = \"debug\"\nbuffer = 100\nhup_rotate = true\n" +
+				"stdout = false\nnegative = -5\npositive = +3\n",
+			values: `{"level"="debug" "buffer"=int64(100) ` +
+				`"hup_rotate"=bool(true) "stdout"=bool(false) ` +
+				`"negative"=int64(-5) "positive"=int64(3)}`},
+		{name: "integer forms",
+			input: "a = 1_000_000\nb = 0x1f\nc = 0o17\nd = 0b101\ne = 0\n",
+			values: `{"a"=int64(1000000) "b"=int64(31) "c"=int64(15) ` +
+				`"d"=int64(5) "e"=int64(0)}`},
+		{name: "trailing comments",
+			input:  "a = \"x\" # comment\nb = 10 # mb\nc = true#no space\n",
+			values: `{"a"="x" "b"=int64(10) "c"=bool(true)}`},
+		{name: "basic strings",
+			input: `a = "quote \" and \\ slash"` + "\n" +
+				`b = "tab\there"` + "\n" + `c = "has # and = inside"` + "\n" +
+				`d = ""` + "\n" + `e = "\u2603"` + "\n",
+			values: `{"a"="quote \" and \\ slash" "b"="tab\there" ` +
+				`"c"="has # and = inside" "d"="" "e"="☃"}`},
+		{name: "literal strings",
+			input:  `path = 'C:\logs\app.log'` + "\n" + `empty = ''` + "\n",
+			values: `{"path"="C:\\logs\\app.log" "empty"=""}`},
+		{name: "crlf and white space",
+			input:  "  a   =   1  \r\n\tb=\"x\"\r\n",
+			values: `{"a"=int64(1) "b"="x"}`},
+		{name: "loggers table keeps order",
+			input: "level = \"info\"\n[loggers]\n\"foo.bar\" = \"debug\"\n" +
+				"foo.baz = \"info\"\n'lit.key' = \"warn\"\n" +
+				"a.\"b.c\" = \"trace\"\n\"x=y\" = \"error\"\n" +
+				"dashed-name = 10\nDEFAULT = \"notice\"\n",
+			values: `{"level"="info" "loggers"={"foo.bar"="debug" ` +
+				`"foo.baz"="info" "lit.key"="warn" "a.b.c"="trace" ` +
+				`"x=y"="error" "dashed-name"=int64(10) "DEFAULT"="notice"}}`},
+		{name: "inline tables",
+			input: "loggers = { \"a.b\" = \"debug\", c = 'info' } # c\n" +
+				"empty = {}\nopts = {n=1,on=true}\n",
+			values: `{"loggers"={"a.b"="debug" "c"="info"} "empty"={} ` +
+				`"opts"={"n"=int64(1) "on"=bool(true)}}`},
+		{name: "top-level dotted keys",
+			input: "loggers.\"foo.bar\" = \"info\"\nloggers.baz = 1\n" +
+				"'a'.b.c = \"x\"\n[loggers]\nqux = \"warn\"\n",
+			values: `{"loggers"={"foo.bar"="info" "baz"=int64(1) ` +
+				`"qux"="warn"} "a"={"b.c"="x"}}`},
+		{name: "table headers",
+			input: "[ loggers ] # comment\na = \"debug\"\n[\"odd]name\"]\n" +
+				"b = 1\n[ dotted . table ]\nc = 2\n",
+			values: `{"loggers"={"a"="debug"} "odd]name"={"b"=int64(1)} ` +
+				`"dotted.table"={"c"=int64(2)}}`},
+	} {
+		values, err := parseKeyValues([]byte(test.input))
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if got := formatSetupTable(values); got != test.values {
+			t.Errorf("%s: got %s, want %s", test.name, got, test.values)
+		}
+	}
+}
+
+func TestParseKeyValuesErrors(t *testing.T) {
+	for _, test := range []struct {
+		input string
+		err   string
+	}{
+		{"level", "line 1: expected key = value"},
+		{"= 1", "line 1: missing key"},
+		{"level =", "line 1: missing value"},
+		{"level = # comment", "line 1: missing value"},
+		{`level = "unterminated`, "line 1: unterminated string"},
+		{`level = 'unterminated`, "line 1: unterminated string"},
+		{`level = "a" b`, `line 1: unexpected "b" after string`},
+		{`level = "\q"`, "line 1: invalid string"},
+		{"level = debug", `line 1: unsupported value "debug"; expected a ` +
+			`string, integer, boolean or inline table`},
+		{"size = 1.5", `line 1: unsupported value "1.5"`},
+		{"at = 1979-05-27", `line 1: unsupported value "1979-05-27"`},
+		{"size = 010", `line 1: invalid integer "010"`},
+		{"size = -0_1", `line 1: invalid integer "-0_1"`},
+		{"size = 99999999999999999999", "line 1: unsupported value"},
+		{"a = [1, 2]", "line 1: arrays are not supported"},
+		{"[[t]]", "line 1: arrays of tables are not supported"},
+		{`a = """x"""`, "line 1: multi-line strings are not supported"},
+		{"a = '''x'''", "line 1: multi-line strings are not supported"},
+		{"a = { b = { c = 1 } }",
+			"line 1: nested inline tables are not supported"},
+		{"a = { b = [1] }", "line 1: arrays are not supported"},
+		{"a = { b = 1, }", "line 1: trailing comma in inline table"},
+		{"a = { b = 1", "line 1: unterminated inline table"},
+		{"a = { b = 1 } c", `line 1: unexpected "c" after inline table`},
+		{"a = { b }", "line 1: expected key = value in inline table"},
+		{"a = { b = 1, b = 2 }", `line 1: duplicate key "b"`},
+		{"a.b = 1\na.b = 2", `line 2: duplicate key "b"`},
+		{"a = 1\na.b = 2", `line 2: "a" is not a table`},
+		{"a b = 1", `line 1: invalid key "a b"`},
+		{"a..b = 1", `line 1: invalid key "a..b"`},
+		{"a. = 1", `line 1: invalid key "a."`},
+		{`"a" b = 1`, `line 1: invalid key`},
+		{"a$ = 1", `line 1: invalid key "a$"`},
+		{"[loggers", "line 1: invalid table header"},
+		{"[loggers] x", "line 1: invalid table header"},
+		{"[]", "line 1: missing key"},
+		{"a = 1\n\na = 2", `line 3: duplicate key "a"`},
+		{"[t]\na = 1\na = 2", `line 3: duplicate key "a"`},
+		{"level = \"x\"\n[level]", `line 2: "level" is not a table`},
+	} {
+		_, err := parseKeyValues([]byte(test.input))
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("parseKeyValues(%q): got error %v, want %q",
+				test.input, err, test.err)
+		}
+	}
+}
+
+func TestSetupFileLevelOrder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spacelog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer ConfigureLoggers("DEFAULT=notice")
+
+	// the DEFAULT entries come after the patterns and the config setting,
+	// and storage.rpc matches both patterns, so the later one must win
+	files := map[string]string{
+		"forward.json": `{"config": "foo.bar=info", "loggers": {` +
+			`"*.rpc": "trace", "storage.*": "debug", "DEFAULT": "error"}}`,
+		"forward.toml": "config = \"foo.bar=info\"\n[loggers]\n" +
+			"\"*.rpc\" = \"trace\"\n\"storage.*\" = \"debug\"\n" +
+			"DEFAULT = \"error\"\n",
+		"reverse.json": `{"config": "foo.bar=info", "loggers": {` +
+			`"storage.*": "debug", "DEFAULT": "error", "*.rpc": "trace"}}`,
+		"reverse.toml": "config = \"foo.bar=info\"\n[loggers]\n" +
+			"\"storage.*\" = \"debug\"\nDEFAULT = \"error\"\n" +
+			"\"*.rpc\" = \"trace\"\n",
+	}
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		err := ioutil.WriteFile(path, []byte(contents), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		config, loggers, _, err := readSetupFile(path, SetupConfig{})
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		err = setupLevels(config, loggers, "test", true)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		storage_rpc := Debug
+		if strings.HasPrefix(name, "reverse") {
+			storage_rpc = Trace
+		}
+		for logger, want := range map[string]LogLevel{
+			"other":       Error,
+			"foo.bar":     Info,
+			"client.rpc":  Trace,
+			"storage.db":  Debug,
+			"storage.rpc": storage_rpc,
+		} {
+			if got := GetLoggerNamed(logger).Level(); got != want {
+				t.Errorf("%s: %s has level %s, want %s", name, logger,
+					got.Name(), want.Name())
+			}
+		}
+	}
+}
@@ -0,0 +1,308 @@
+// Copyright (C) 2017 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spacelog
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// ContextExtractor pulls structured fields, such as a request ID or trace ID,
+// out of a context.Context. It should return nil if the context has nothing
+// of interest.
+type ContextExtractor func(ctx context.Context) Fields
+
+type contextExtractors struct {
+	mtx        sync.RWMutex
+	extractors []ContextExtractor
+}
+
+type contextFieldsKey struct{}
+
+type contextLevelKey struct{}
+
+// ContextWithFields returns a new context carrying the given alternating keys
+// and values as structured fields, in addition to any fields already carried
+// by ctx. Loggers called with the *Ctx methods add these fields to the log
+// event.
+func ContextWithFields(ctx context.Context,
+	keyvals ...interface{}) context.Context {
+	return context.WithValue(ctx, contextFieldsKey{},
+		FieldsFromContext(ctx).concat(MakeFields(keyvals...)))
+}
+
+// FieldsFromContext returns the fields added to ctx with ContextWithFields.
+func FieldsFromContext(ctx context.Context) Fields {
+	if ctx == nil {
+		return nil
+	}
+	fields, _ := ctx.Value(contextFieldsKey{}).(Fields)
+	return fields
+}
+
+// ContextWithLevel returns a new context that escalates logging to the given
+// level. Loggers called with the *Ctx methods, or derived with WithContext,
+// log events at that level or above even if the Logger's own level is less
+// permissive. This allows turning on debug logging for a single request
+// without changing the level of any Logger.
+func ContextWithLevel(ctx context.Context, level LogLevel) context.Context {
+	return context.WithValue(ctx, contextLevelKey{}, level)
+}
+
+// LevelFromContext returns the level set on ctx with ContextWithLevel, if
+// any.
+func LevelFromContext(ctx context.Context) (level LogLevel, ok bool) {
+	if ctx == nil {
+		return 0, false
+	}
+	level, ok = ctx.Value(contextLevelKey{}).(LogLevel)
+	return level, ok
+}
+
+// AddContextExtractor registers a ContextExtractor with the collection. Every
+// log event made through one of the *Ctx Logger methods gets the fields from
+// ContextWithFields followed by the fields from each registered extractor,
+// in registration order.
+func (c *LoggerCollection) AddContextExtractor(extractor ContextExtractor) {
+	c.extractors.mtx.Lock()
+	defer c.extractors.mtx.Unlock()
+	c.extractors.extractors = append(c.extractors.extractors, extractor)
+}
+
+func (c *LoggerCollection) contextFields(ctx context.Context) Fields {
+	if ctx == nil {
+		return nil
+	}
+	fields := FieldsFromContext(ctx)
+	c.extractors.mtx.RLock()
+	extractors := c.extractors.extractors
+	c.extractors.mtx.RUnlock()
+	for _, extractor := range extractors {
+		fields = fields.concat(extractor(ctx))
+	}
+	return fields
+}
+
+// AddContextExtractor registers a ContextExtractor with the default logger
+// collection.
+func AddContextExtractor(extractor ContextExtractor) {
+	DefaultLoggerCollection.AddContextExtractor(extractor)
+}
+
+// WithContext returns a new Logger with the fields extracted from ctx
+// attached, as with With. If ctx has a level set with ContextWithLevel, the
+// new Logger is escalated to that level. The *Ctx methods of the new Logger
+// don't attach the fields of that same ctx a second time, but they do attach
+// all the fields of any other context, including one derived from ctx.
+func (l *Logger) WithContext(ctx context.Context) *Logger {
+	fields := l.collection.contextFields(ctx)
+	level, escalated := LevelFromContext(ctx)
+	if len(fields) == 0 && !escalated {
+		return l
+	}
+	derived := &Logger{name: l.name, collection: l.collection,
+		base: l.root(), fields: l.fields.concat(fields),
+		escalated: l.escalated, escalation: l.escalation, ctx: ctx}
+	if escalated && (!derived.escalated || level < derived.escalation) {
+		derived.escalated, derived.escalation = true, level
+	}
+	return derived
+}
+
+// contextFields returns the fields extracted from ctx, or nil if WithContext
+// already attached them to this Logger.
+func (l *Logger) contextFields(ctx context.Context) Fields {
+	if l.ctx != nil && sameContext(l.ctx, ctx) {
+		return nil
+	}
+	return l.collection.contextFields(ctx)
+}
+
+// sameContext compares contexts without panicking on uncomparable ones.
+func sameContext(a, b context.Context) bool {
+	t := reflect.TypeOf(a)
+	return t == reflect.TypeOf(b) && t.Comparable() && a == b
+}
+
+// enabledCtx returns true if the logger's level, or the level set on ctx
+// with ContextWithLevel, is the provided level or even more permissive.
+func (l *Logger) enabledCtx(ctx context.Context, level LogLevel) bool {
+	if l.getLevel() <= level {
+		return true
+	}
+	ctx_level, ok := LevelFromContext(ctx)
+	return ok && ctx_level <= level
+}
+
+// LevelEnabledCtx returns true if the logger's level, or the level set on
+// ctx with ContextWithLevel, is the provided level or even more permissive.
+func (l *Logger) LevelEnabledCtx(ctx context.Context, level LogLevel) bool {
+	return l.enabledCtx(ctx, level)
+}
+
+// TraceCtx logs a collection of values, with fields extracted from ctx, if the
+// logger's level or the level set on ctx is trace or even more permissive.
+func (l *Logger) TraceCtx(ctx context.Context, v ...interface{}) {
+	if l.enabledCtx(ctx, Trace) {
+		l.output(Trace, fmt.Sprint(v...), 1, l.contextFields(ctx))
+	}
+}
+
+// TracefCtx logs a format string with values, with fields extracted from ctx,
+// if the logger's level or the level set on ctx is trace or even more
+// permissive.
+func (l *Logger) TracefCtx(ctx context.Context, format string,
+	v ...interface{}) {
+	if l.enabledCtx(ctx, Trace) {
+		l.output(Trace, fmt.Sprintf(format, v...), 1,
+			l.contextFields(ctx))
+	}
+}
+
+// DebugCtx logs a collection of values, with fields extracted from ctx, if the
+// logger's level or the level set on ctx is debug or even more permissive.
+func (l *Logger) DebugCtx(ctx context.Context, v ...interface{}) {
+	if l.enabledCtx(ctx, Debug) {
+		l.output(Debug, fmt.Sprint(v...), 1, l.contextFields(ctx))
+	}
+}
+
+// DebugfCtx logs a format string with values, with fields extracted from ctx,
+// if the logger's level or the level set on ctx is debug or even more
+// permissive.
+func (l *Logger) DebugfCtx(ctx context.Context, format string,
+	v ...interface{}) {
+	if l.enabledCtx(ctx, Debug) {
+		l.output(Debug, fmt.Sprintf(format, v...), 1,
+			l.contextFields(ctx))
+	}
+}
+
+// InfoCtx logs a collection of values, with fields extracted from ctx, if the
+// logger's level or the level set on ctx is info or even more permissive.
+func (l *Logger) InfoCtx(ctx context.Context, v ...interface{}) {
+	if l.enabledCtx(ctx, Info) {
+		l.output(Info, fmt.Sprint(v...), 1, l.contextFields(ctx))
+	}
+}
+
+// InfofCtx logs a format string with values, with fields extracted from ctx, if
+// the logger's level or the level set on ctx is info or even more permissive.
+func (l *Logger) InfofCtx(ctx context.Context, format string,
+	v ...interface{}) {
+	if l.enabledCtx(ctx, Info) {
+		l.output(Info, fmt.Sprintf(format, v...), 1,
+			l.contextFields(ctx))
+	}
+}
+
+// NoticeCtx logs a collection of values, with fields extracted from ctx, if the
+// logger's level or the level set on ctx is notice or even more permissive.
+func (l *Logger) NoticeCtx(ctx context.Context, v ...interface{}) {
+	if l.enabledCtx(ctx, Notice) {
+		l.output(Notice, fmt.Sprint(v...), 1, l.contextFields(ctx))
+	}
+}
+
+// NoticefCtx logs a format string with values, with fields extracted from ctx,
+// if the logger's level or the level set on ctx is notice or even more
+// permissive.
+func (l *Logger) NoticefCtx(ctx context.Context, format string,
+	v ...interface{}) {
+	if l.enabledCtx(ctx, Notice) {
+		l.output(Notice, fmt.Sprintf(format, v...), 1,
+			l.contextFields(ctx))
+	}
+}
+
+// WarnCtx logs a collection of values, with fields extracted from ctx, if the
+// logger's level or the level set on ctx is warning or even more permissive.
+func (l *Logger) WarnCtx(ctx context.Context, v ...interface{}) {
+	if l.enabledCtx(ctx, Warning) {
+		l.output(Warning, fmt.Sprint(v...), 1, l.contextFields(ctx))
+	}
+}
+
+// WarnfCtx logs a format string with values, with fields extracted from ctx, if
+// the logger's level or the level set on ctx is warning or even more
+// permissive.
+func (l *Logger) WarnfCtx(ctx context.Context, format string,
+	v ...interface{}) {
+	if l.enabledCtx(ctx, Warning) {
+		l.output(Warning, fmt.Sprintf(format, v...), 1,
+			l.contextFields(ctx))
+	}
+}
+
+// ErrorCtx logs a collection of values, with fields extracted from ctx, if the
+// logger's level or the level set on ctx is error or even more permissive.
+func (l *Logger) ErrorCtx(ctx context.Context, v ...interface{}) {
+	if l.enabledCtx(ctx, Error) {
+		l.output(Error, fmt.Sprint(v...), 1, l.contextFields(ctx))
+	}
+}
+
+// ErrorfCtx logs a format string with values, with fields extracted from ctx,
+// if the logger's level or the level set on ctx is error or even more
+// permissive.
+func (l *Logger) ErrorfCtx(ctx context.Context, format string,
+	v ...interface{}) {
+	if l.enabledCtx(ctx, Error) {
+		l.output(Error, fmt.Sprintf(format, v...), 1,
+			l.contextFields(ctx))
+	}
+}
+
+// CritCtx logs a collection of values, with fields extracted from ctx, if the
+// logger's level or the level set on ctx is critical or even more permissive.
+func (l *Logger) CritCtx(ctx context.Context, v ...interface{}) {
+	if l.enabledCtx(ctx, Critical) {
+		l.output(Critical, fmt.Sprint(v...), 1, l.contextFields(ctx))
+	}
+}
+
+// CritfCtx logs a format string with values, with fields extracted from ctx, if
+// the logger's level or the level set on ctx is critical or even more
+// permissive.
+func (l *Logger) CritfCtx(ctx context.Context, format string,
+	v ...interface{}) {
+	if l.enabledCtx(ctx, Critical) {
+		l.output(Critical, fmt.Sprintf(format, v...), 1,
+			l.contextFields(ctx))
+	}
+}
+
+// LogCtx logs a collection of values, with fields extracted from ctx, if the
+// logger's level or the level set on ctx is the provided level or even more
+// permissive.
+func (l *Logger) LogCtx(ctx context.Context, level LogLevel,
+	v ...interface{}) {
+	if l.enabledCtx(ctx, level) {
+		l.output(level, fmt.Sprint(v...), 1, l.contextFields(ctx))
+	}
+}
+
+// LogfCtx logs a format string with values, with fields extracted from ctx, if
+// the logger's level or the level set on ctx is the provided level or even more
+// permissive.
+func (l *Logger) LogfCtx(ctx context.Context, level LogLevel, format string,
+	v ...interface{}) {
+	if l.enabledCtx(ctx, level) {
+		l.output(level, fmt.Sprintf(format, v...), 1,
+			l.contextFields(ctx))
+	}
+}
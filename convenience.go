@@ -23,7 +23,7 @@ import (
 // more permissive.
 func (l *Logger) Trace(v ...interface{}) {
 	if l.getLevel() <= Trace {
-		l.getHandler().Log(l.name, Trace, fmt.Sprint(v...), 1)
+		l.output(Trace, fmt.Sprint(v...), 1, nil)
 	}
 }
 
@@ -31,7 +31,7 @@ func (l *Logger) Trace(v ...interface{}) {
 // even more permissive.
 func (l *Logger) Tracef(format string, v ...interface{}) {
 	if l.getLevel() <= Trace {
-		l.getHandler().Log(l.name, Trace, fmt.Sprintf(format, v...), 1)
+		l.output(Trace, fmt.Sprintf(format, v...), 1, nil)
 	}
 }
 
@@ -39,7 +39,15 @@ func (l *Logger) Tracef(format string, v ...interface{}) {
 // is trace or even more permissive.
 func (l *Logger) Tracee(err error) {
 	if l.getLevel() <= Trace && err != nil {
-		l.getHandler().Log(l.name, Trace, err.Error(), 1)
+		l.output(Trace, err.Error(), 1, nil)
+	}
+}
+
+// Tracew logs a message with structured fields, given as alternating keys and
+// values, if the logger's level is trace or even more permissive.
+func (l *Logger) Tracew(msg string, keyvals ...interface{}) {
+	if l.getLevel() <= Trace {
+		l.output(Trace, msg, 1, MakeFields(keyvals...))
 	}
 }
 
@@ -53,7 +61,7 @@ func (l *Logger) TraceEnabled() bool {
 // more permissive.
 func (l *Logger) Debug(v ...interface{}) {
 	if l.getLevel() <= Debug {
-		l.getHandler().Log(l.name, Debug, fmt.Sprint(v...), 1)
+		l.output(Debug, fmt.Sprint(v...), 1, nil)
 	}
 }
 
@@ -61,7 +69,7 @@ func (l *Logger) Debug(v ...interface{}) {
 // even more permissive.
 func (l *Logger) Debugf(format string, v ...interface{}) {
 	if l.getLevel() <= Debug {
-		l.getHandler().Log(l.name, Debug, fmt.Sprintf(format, v...), 1)
+		l.output(Debug, fmt.Sprintf(format, v...), 1, nil)
 	}
 }
 
@@ -69,7 +77,15 @@ func (l *Logger) Debugf(format string, v ...interface{}) {
 // is debug or even more permissive.
 func (l *Logger) Debuge(err error) {
 	if l.getLevel() <= Debug && err != nil {
-		l.getHandler().Log(l.name, Debug, err.Error(), 1)
+		l.output(Debug, err.Error(), 1, nil)
+	}
+}
+
+// Debugw logs a message with structured fields, given as alternating keys and
+// values, if the logger's level is debug or even more permissive.
+func (l *Logger) Debugw(msg string, keyvals ...interface{}) {
+	if l.getLevel() <= Debug {
+		l.output(Debug, msg, 1, MakeFields(keyvals...))
 	}
 }
 
@@ -83,7 +99,7 @@ func (l *Logger) DebugEnabled() bool {
 // more permissive.
 func (l *Logger) Info(v ...interface{}) {
 	if l.getLevel() <= Info {
-		l.getHandler().Log(l.name, Info, fmt.Sprint(v...), 1)
+		l.output(Info, fmt.Sprint(v...), 1, nil)
 	}
 }
 
@@ -91,7 +107,7 @@ func (l *Logger) Info(v ...interface{}) {
 // even more permissive.
 func (l *Logger) Infof(format string, v ...interface{}) {
 	if l.getLevel() <= Info {
-		l.getHandler().Log(l.name, Info, fmt.Sprintf(format, v...), 1)
+		l.output(Info, fmt.Sprintf(format, v...), 1, nil)
 	}
 }
 
@@ -99,7 +115,15 @@ func (l *Logger) Infof(format string, v ...interface{}) {
 // is info or even more permissive.
 func (l *Logger) Infoe(err error) {
 	if l.getLevel() <= Info && err != nil {
-		l.getHandler().Log(l.name, Info, err.Error(), 1)
+		l.output(Info, err.Error(), 1, nil)
+	}
+}
+
+// Infow logs a message with structured fields, given as alternating keys and
+// values, if the logger's level is info or even more permissive.
+func (l *Logger) Infow(msg string, keyvals ...interface{}) {
+	if l.getLevel() <= Info {
+		l.output(Info, msg, 1, MakeFields(keyvals...))
 	}
 }
 
@@ -113,7 +137,7 @@ func (l *Logger) InfoEnabled() bool {
 // more permissive.
 func (l *Logger) Notice(v ...interface{}) {
 	if l.getLevel() <= Notice {
-		l.getHandler().Log(l.name, Notice, fmt.Sprint(v...), 1)
+		l.output(Notice, fmt.Sprint(v...), 1, nil)
 	}
 }
 
@@ -121,7 +145,7 @@ func (l *Logger) Notice(v ...interface{}) {
 // even more permissive.
 func (l *Logger) Noticef(format string, v ...interface{}) {
 	if l.getLevel() <= Notice {
-		l.getHandler().Log(l.name, Notice, fmt.Sprintf(format, v...), 1)
+		l.output(Notice, fmt.Sprintf(format, v...), 1, nil)
 	}
 }
 
@@ -129,7 +153,15 @@ func (l *Logger) Noticef(format string, v ...interface{}) {
 // is notice or even more permissive.
 func (l *Logger) Noticee(err error) {
 	if l.getLevel() <= Notice && err != nil {
-		l.getHandler().Log(l.name, Notice, err.Error(), 1)
+		l.output(Notice, err.Error(), 1, nil)
+	}
+}
+
+// Noticew logs a message with structured fields, given as alternating keys and
+// values, if the logger's level is notice or even more permissive.
+func (l *Logger) Noticew(msg string, keyvals ...interface{}) {
+	if l.getLevel() <= Notice {
+		l.output(Notice, msg, 1, MakeFields(keyvals...))
 	}
 }
 
@@ -143,7 +175,7 @@ func (l *Logger) NoticeEnabled() bool {
 // more permissive.
 func (l *Logger) Warn(v ...interface{}) {
 	if l.getLevel() <= Warning {
-		l.getHandler().Log(l.name, Warning, fmt.Sprint(v...), 1)
+		l.output(Warning, fmt.Sprint(v...), 1, nil)
 	}
 }
 
@@ -151,7 +183,7 @@ func (l *Logger) Warn(v ...interface{}) {
 // even more permissive.
 func (l *Logger) Warnf(format string, v ...interface{}) {
 	if l.getLevel() <= Warning {
-		l.getHandler().Log(l.name, Warning, fmt.Sprintf(format, v...), 1)
+		l.output(Warning, fmt.Sprintf(format, v...), 1, nil)
 	}
 }
 
@@ -159,7 +191,15 @@ func (l *Logger) Warnf(format string, v ...interface{}) {
 // is warning or even more permissive.
 func (l *Logger) Warne(err error) {
 	if l.getLevel() <= Warning && err != nil {
-		l.getHandler().Log(l.name, Warning, err.Error(), 1)
+		l.output(Warning, err.Error(), 1, nil)
+	}
+}
+
+// Warnw logs a message with structured fields, given as alternating keys and
+// values, if the logger's level is warning or even more permissive.
+func (l *Logger) Warnw(msg string, keyvals ...interface{}) {
+	if l.getLevel() <= Warning {
+		l.output(Warning, msg, 1, MakeFields(keyvals...))
 	}
 }
 
@@ -173,7 +213,7 @@ func (l *Logger) WarnEnabled() bool {
 // more permissive.
 func (l *Logger) Error(v ...interface{}) {
 	if l.getLevel() <= Error {
-		l.getHandler().Log(l.name, Error, fmt.Sprint(v...), 1)
+		l.output(Error, fmt.Sprint(v...), 1, nil)
 	}
 }
 
@@ -181,7 +221,7 @@ func (l *Logger) Error(v ...interface{}) {
 // even more permissive.
 func (l *Logger) Errorf(format string, v ...interface{}) {
 	if l.getLevel() <= Error {
-		l.getHandler().Log(l.name, Error, fmt.Sprintf(format, v...), 1)
+		l.output(Error, fmt.Sprintf(format, v...), 1, nil)
 	}
 }
 
@@ -189,7 +229,15 @@ func (l *Logger) Errorf(format string, v ...interface{}) {
 // is error or even more permissive.
 func (l *Logger) Errore(err error) {
 	if l.getLevel() <= Error && err != nil {
-		l.getHandler().Log(l.name, Error, err.Error(), 1)
+		l.output(Error, err.Error(), 1, nil)
+	}
+}
+
+// Errorw logs a message with structured fields, given as alternating keys and
+// values, if the logger's level is error or even more permissive.
+func (l *Logger) Errorw(msg string, keyvals ...interface{}) {
+	if l.getLevel() <= Error {
+		l.output(Error, msg, 1, MakeFields(keyvals...))
 	}
 }
 
@@ -203,7 +251,7 @@ func (l *Logger) ErrorEnabled() bool {
 // more permissive.
 func (l *Logger) Crit(v ...interface{}) {
 	if l.getLevel() <= Critical {
-		l.getHandler().Log(l.name, Critical, fmt.Sprint(v...), 1)
+		l.output(Critical, fmt.Sprint(v...), 1, nil)
 	}
 }
 
@@ -211,7 +259,7 @@ func (l *Logger) Crit(v ...interface{}) {
 // even more permissive.
 func (l *Logger) Critf(format string, v ...interface{}) {
 	if l.getLevel() <= Critical {
-		l.getHandler().Log(l.name, Critical, fmt.Sprintf(format, v...), 1)
+		l.output(Critical, fmt.Sprintf(format, v...), 1, nil)
 	}
 }
 
@@ -219,7 +267,15 @@ func (l *Logger) Critf(format string, v ...interface{}) {
 // is critical or even more permissive.
 func (l *Logger) Crite(err error) {
 	if l.getLevel() <= Critical && err != nil {
-		l.getHandler().Log(l.name, Critical, err.Error(), 1)
+		l.output(Critical, err.Error(), 1, nil)
+	}
+}
+
+// Critw logs a message with structured fields, given as alternating keys and
+// values, if the logger's level is critical or even more permissive.
+func (l *Logger) Critw(msg string, keyvals ...interface{}) {
+	if l.getLevel() <= Critical {
+		l.output(Critical, msg, 1, MakeFields(keyvals...))
 	}
 }
 
@@ -233,7 +289,7 @@ func (l *Logger) CritEnabled() bool {
 // or even more permissive.
 func (l *Logger) Log(level LogLevel, v ...interface{}) {
 	if l.getLevel() <= level {
-		l.getHandler().Log(l.name, level, fmt.Sprint(v...), 1)
+		l.output(level, fmt.Sprint(v...), 1, nil)
 	}
 }
 
@@ -241,7 +297,7 @@ func (l *Logger) Log(level LogLevel, v ...interface{}) {
 // level or even more permissive.
 func (l *Logger) Logf(level LogLevel, format string, v ...interface{}) {
 	if l.getLevel() <= level {
-		l.getHandler().Log(l.name, level, fmt.Sprintf(format, v...), 1)
+		l.output(level, fmt.Sprintf(format, v...), 1, nil)
 	}
 }
 
@@ -249,7 +305,15 @@ func (l *Logger) Logf(level LogLevel, format string, v ...interface{}) {
 // is the provided level or even more permissive.
 func (l *Logger) Loge(level LogLevel, err error) {
 	if l.getLevel() <= level && err != nil {
-		l.getHandler().Log(l.name, level, err.Error(), 1)
+		l.output(level, err.Error(), 1, nil)
+	}
+}
+
+// Logw logs a message with structured fields, given as alternating keys and
+// values, if the logger's level is the provided level or even more permissive.
+func (l *Logger) Logw(level LogLevel, msg string, keyvals ...interface{}) {
+	if l.getLevel() <= level {
+		l.output(level, msg, 1, MakeFields(keyvals...))
 	}
 }
 
@@ -266,7 +330,7 @@ type writer struct {
 
 func (w *writer) Write(data []byte) (int, error) {
 	if w.l.getLevel() <= w.level {
-		w.l.getHandler().Log(w.l.name, w.level, string(data), 1)
+		w.l.output(w.level, string(data), 1, nil)
 	}
 	return len(data), nil
 }
@@ -283,7 +347,7 @@ type writerNoCaller struct {
 
 func (w *writerNoCaller) Write(data []byte) (int, error) {
 	if w.l.getLevel() <= w.level {
-		w.l.getHandler().Log(w.l.name, w.level, string(data), -1)
+		w.l.output(w.level, string(data), -1, nil)
 	}
 	return len(data), nil
 }
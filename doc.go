@@ -23,14 +23,30 @@ what the programmer typically interacts with for creating log messages. A
 Logger will be at a given log level, and if log messages can clear that
 specific logger's log level filter, they will be passed off to the Handler.
 
-Loggers are instantiated from GetLogger and GetLoggerNamed.
+Loggers are instantiated from GetLogger and GetLoggerNamed. A Logger can carry
+structured key/value fields, added with its With method, which are passed to
+Handlers that implement FieldHandler.
 
 A Handler is a very generic interface for handling log events. You can provide
 your own Handler for doing structured JSON output or colorized output or
 countless other things.
 
-Provided are a simple TextHandler with a variety of log event templates and
-TextOutput sinks, such as io.Writer, Syslog, and so forth.
+Provided are a simple TextHandler with a variety of log event templates, a
+JSONHandler that writes one JSON object per log event, a LogfmtHandler that
+writes key=value lines (which ParseLogfmt can read back), a MultiHandler that
+sends events to several Handlers, each with its own minimum level, a
+RouteHandler that picks a Handler by level and logger name, and TextOutput
+sinks, such as io.Writer, Syslog, and so forth.
+
+Handlers and outputs that hold on to log events implement Flusher and
+io.Closer. Use Flush and Close to write out buffered events, or Exit and
+CloseOnSignal to do so as the process exits.
+
+Outputs and Handlers that implement StatsReporter count what they write and
+what fails. Stats and Health report on everything in use, and SetErrorHandler
+hears about each failure as it happens. A FailoverOutput uses those counts to
+move to fallback outputs while its primary output is failing, without losing
+messages, and to move back once the primary recovers.
 
 Make sure to see the source of the setup subpackage for an example of easy and
 configurable logging setup at process start:
@@ -0,0 +1,89 @@
+// Copyright (C) 2017 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spacelog
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// DefaultSetupConfig returns a SetupConfig with every field set to the value
+// in its default tag, which is what the setup subpackage's flags default to.
+func DefaultSetupConfig() SetupConfig {
+	var config SetupConfig
+	v := reflect.ValueOf(&config).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		err := setSetupField(v.Field(i), v.Type().Field(i).Tag.Get("default"))
+		if err != nil {
+			panic(fmt.Sprintf("invalid default for SetupConfig.%s: %s",
+				v.Type().Field(i).Name, err))
+		}
+	}
+	return config
+}
+
+// SetupConfigFromEnv returns config with each field that has a corresponding
+// environment variable set to that variable's value. A field's variable is
+// SPACELOG_ followed by its name in upper case with words separated by
+// underscores, such as SPACELOG_LEVEL, SPACELOG_OUTPUT or
+// SPACELOG_ROTATE_SIZE. A variable that is set but empty clears its field.
+//
+// Environment variables take precedence over whatever is in config, so to
+// let explicit settings override the environment, apply them afterwards:
+//
+//	config, err := spacelog.SetupConfigFromEnv(spacelog.DefaultSetupConfig())
+//	// ... apply explicit settings to config ...
+//	err = spacelog.Setup(procname, config)
+//
+// The setup subpackage does this with its flags, so flags given on the
+// command line override the environment, which overrides the flag defaults.
+// Settings in a ConfigFile override all of these.
+func SetupConfigFromEnv(config SetupConfig) (SetupConfig, error) {
+	v := reflect.ValueOf(&config).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		err := setEnvField(v.Field(i), v.Type().Field(i).Name)
+		if err != nil {
+			return config, err
+		}
+	}
+	return config, nil
+}
+
+// setEnvField sets field from the environment variable for the SetupConfig
+// field with the given name, if it is set.
+func setEnvField(field reflect.Value, name string) error {
+	env_name := setupEnvName(name)
+	value, ok := os.LookupEnv(env_name)
+	if !ok {
+		return nil
+	}
+	if value == "" {
+		field.Set(reflect.Zero(field.Type()))
+		return nil
+	}
+	err := setSetupField(field, value)
+	if err != nil {
+		return fmt.Errorf("%s: %s", env_name, err)
+	}
+	return nil
+}
+
+// setupEnvName returns the environment variable SetupConfigFromEnv reads for
+// the SetupConfig field with the given name.
+func setupEnvName(field string) string {
+	return "SPACELOG_" + strings.ToUpper(splitWords(field, '_'))
+}
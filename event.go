@@ -32,6 +32,7 @@ type LogEvent struct {
 	Filepath   string
 	Line       int
 	Timestamp  time.Time
+	Fields     Fields
 
 	TermColors
 }
@@ -64,6 +65,13 @@ func (l *LogEvent) Date() string {
 	return l.Timestamp.Format("2006/01/02")
 }
 
+// Field returns the value of the structured field with the given key, or nil
+// if there is no such field.
+func (l *LogEvent) Field(key string) interface{} {
+	value, _ := l.Fields.Get(key)
+	return value
+}
+
 // LevelJustified returns the log level in string form justified so that all
 // log levels take the same text width.
 func (l *LogEvent) LevelJustified() (rv string) {
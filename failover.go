@@ -0,0 +1,187 @@
+// Copyright (C) 2017 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spacelog
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const defaultFailoverProbe = 30 * time.Second
+
+// FailoverOutput is a TextOutput that writes to a primary output, and to a
+// chain of fallback outputs while the primary is failing. A message that an
+// output fails to write is written to the next output in the chain, so it
+// isn't lost unless every output fails. While a fallback is in use, the
+// FailoverOutput periodically tries the primary again with a real message,
+// and switches back once the primary writes it successfully.
+//
+// Failures are detected through the outputs' StatsReporter counts: an output
+// fails a message if its error or dropped count goes up while writing it.
+// Outputs that aren't StatsReporters never fail. The outputs should write
+// synchronously, so put any BufferedOutput in front of the FailoverOutput
+// rather than behind it.
+type FailoverOutput struct {
+	mtx        sync.Mutex
+	outputs    []TextOutput
+	probe      time.Duration
+	current    int
+	next_probe time.Time
+	health     outputHealth
+}
+
+// NewFailoverOutput returns a FailoverOutput writing to primary, and to each
+// of fallbacks in turn while the outputs before them are failing. The
+// primary is tried again every probe; if probe isn't positive, every 30
+// seconds.
+func NewFailoverOutput(probe time.Duration, primary TextOutput,
+	fallbacks ...TextOutput) *FailoverOutput {
+	if probe <= 0 {
+		probe = defaultFailoverProbe
+	}
+	return &FailoverOutput{
+		outputs: append([]TextOutput{primary}, fallbacks...),
+		probe:   probe}
+}
+
+// Output writes the message to the current output, or to the outputs after
+// it if it fails, trying the primary first if it is time to probe it.
+func (f *FailoverOutput) Output(level LogLevel, message []byte) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	now := time.Now()
+	start := f.current
+	if start > 0 && !now.Before(f.next_probe) {
+		start = 0
+		f.next_probe = now.Add(f.probe)
+	}
+	var failure error
+	for i := start; i < len(f.outputs); i++ {
+		err := f.try(i, level, message)
+		if err == nil {
+			f.health.wrote(len(message), 1)
+			if i != f.current {
+				f.switchTo(i, now, failure)
+			}
+			return
+		}
+		if i == f.current {
+			failure = err
+		}
+	}
+	f.health.dropped(1)
+}
+
+// try writes the message to the i'th output, returning its error if it
+// failed.
+func (f *FailoverOutput) try(i int, level LogLevel, message []byte) error {
+	output := f.outputs[i]
+	reporter, ok := output.(StatsReporter)
+	if !ok {
+		output.Output(level, message)
+		return nil
+	}
+	before := reporter.Stats()
+	output.Output(level, message)
+	after := reporter.Stats()
+	if after.Errors == before.Errors && after.Dropped == before.Dropped {
+		return nil
+	}
+	if after.LastError != nil {
+		return after.LastError
+	}
+	return fmt.Errorf("message dropped")
+}
+
+// switchTo makes the i'th output the current one, noting the switch in it.
+// If i comes after the current output, failure is why the current output
+// was abandoned.
+func (f *FailoverOutput) switchTo(i int, now time.Time, failure error) {
+	var note string
+	if i < f.current {
+		note = fmt.Sprintf("spacelog: log output %d recovered; switched "+
+			"back from output %d", i, f.current)
+	} else {
+		note = fmt.Sprintf("spacelog: log output %d failed; switched to "+
+			"output %d", f.current, i)
+		if f.current == 0 {
+			f.next_probe = now.Add(f.probe)
+		}
+		f.health.failedOver(fmt.Errorf("log output %d failed; switched to "+
+			"output %d: %s", f.current, i, failure))
+	}
+	f.current = i
+	f.outputs[i].Output(Warning, []byte(note))
+}
+
+// Current returns the output in use, and its position in the chain, where
+// the primary is 0.
+func (f *FailoverOutput) Current() (TextOutput, int) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	return f.outputs[f.current], f.current
+}
+
+// OnHup passes the HUP on to each output that handles it
+func (f *FailoverOutput) OnHup() {
+	for _, output := range f.outputs {
+		if hh, ok := output.(HupHandlingTextOutput); ok {
+			hh.OnHup()
+		}
+	}
+}
+
+// Flush flushes each output, returning the first error encountered
+func (f *FailoverOutput) Flush() (err error) {
+	for _, output := range f.outputs {
+		if ferr := flushValue(output); err == nil {
+			err = ferr
+		}
+	}
+	return err
+}
+
+// Close closes each output, returning the first error encountered
+func (f *FailoverOutput) Close() (err error) {
+	for _, output := range f.outputs {
+		if cerr := closeValue(output); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// Stats counts the messages written to any output as Events, switches to a
+// fallback as Failovers, and messages no output could write as Dropped. What
+// each output writes, and how it fails, is in its own Stats.
+func (f *FailoverOutput) Stats() OutputStats {
+	return f.health.Stats()
+}
+
+// SetErrorHandler registers fn to be called when an output fails and the
+// FailoverOutput moves on to the next. The output's own error goes to its
+// own error handler.
+func (f *FailoverOutput) SetErrorHandler(fn func(error)) {
+	f.health.SetErrorHandler(fn)
+}
+
+func (f *FailoverOutput) logChildren() []interface{} {
+	children := make([]interface{}, 0, len(f.outputs))
+	for _, output := range f.outputs {
+		children = append(children, output)
+	}
+	return children
+}
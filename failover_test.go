@@ -0,0 +1,136 @@
+// Copyright (C) 2017 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spacelog
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// failingWriter records the lines written to it, or fails them while fail
+// is set.
+type failingWriter struct {
+	mtx      sync.Mutex
+	fail     bool
+	attempts int
+	lines    []string
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	w.attempts++
+	if w.fail {
+		return 0, errors.New("disk full")
+	}
+	w.lines = append(w.lines, strings.TrimSpace(string(p)))
+	return len(p), nil
+}
+
+func (w *failingWriter) setFailing(fail bool) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	w.fail = fail
+}
+
+func (w *failingWriter) written() (lines []string, attempts int) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	return append([]string(nil), w.lines...), w.attempts
+}
+
+func checkLines(t *testing.T, what string, w *failingWriter, want ...string) {
+	t.Helper()
+	lines, _ := w.written()
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("%s: got %q, want %q", what, lines, want)
+	}
+}
+
+func TestFailoverOutput(t *testing.T) {
+	primary, fallback := &failingWriter{}, &failingWriter{}
+	// probes are started by hand, so the probe interval never elapses
+	f := NewFailoverOutput(time.Hour, NewWriterOutput(primary),
+		NewWriterOutput(fallback))
+	var failures []error
+	f.SetErrorHandler(func(err error) { failures = append(failures, err) })
+	probe := func() {
+		f.mtx.Lock()
+		f.next_probe = time.Now()
+		f.mtx.Unlock()
+	}
+
+	f.Output(Info, []byte("a"))
+	checkLines(t, "primary", primary, "a")
+	checkLines(t, "fallback", fallback)
+
+	// a failed message goes to the fallback, which is used from then on
+	primary.setFailing(true)
+	f.Output(Info, []byte("b"))
+	f.Output(Info, []byte("c"))
+	if _, i := f.Current(); i != 1 {
+		t.Fatalf("got output %d after a failure, want 1", i)
+	}
+	checkLines(t, "fallback", fallback, "b",
+		"spacelog: log output 0 failed; switched to output 1", "c")
+	if _, attempts := primary.written(); attempts != 2 {
+		t.Errorf("primary tried %d times, want 2", attempts)
+	}
+	if len(failures) != 1 ||
+		!strings.Contains(failures[0].Error(), "disk full") {
+		t.Errorf("got failures %v, want one for the disk being full",
+			failures)
+	}
+
+	// a failed probe leaves the fallback in use
+	probe()
+	f.Output(Info, []byte("d"))
+	f.Output(Info, []byte("e"))
+	if _, attempts := primary.written(); attempts != 3 {
+		t.Errorf("primary tried %d times, want 3", attempts)
+	}
+	if _, i := f.Current(); i != 1 {
+		t.Fatalf("got output %d after a failed probe, want 1", i)
+	}
+
+	// once the primary works, it isn't used again until it is probed
+	primary.setFailing(false)
+	f.Output(Info, []byte("f"))
+	checkLines(t, "primary", primary, "a")
+	probe()
+	f.Output(Info, []byte("g"))
+	f.Output(Info, []byte("h"))
+	if _, i := f.Current(); i != 0 {
+		t.Fatalf("got output %d after a successful probe, want 0", i)
+	}
+	checkLines(t, "primary", primary, "a", "g",
+		"spacelog: log output 0 recovered; switched back from output 1", "h")
+	checkLines(t, "fallback", fallback, "b",
+		"spacelog: log output 0 failed; switched to output 1", "c", "d", "e",
+		"f")
+
+	// a message that no output can write is dropped
+	primary.setFailing(true)
+	fallback.setFailing(true)
+	f.Output(Info, []byte("i"))
+	stats := f.Stats()
+	if stats.Events != 8 || stats.Dropped != 1 || stats.Failovers != 1 {
+		t.Errorf("got %d events, %d dropped and %d failovers, "+
+			"want 8, 1 and 1", stats.Events, stats.Dropped, stats.Failovers)
+	}
+}
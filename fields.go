@@ -0,0 +1,122 @@
+// Copyright (C) 2017 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spacelog
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+)
+
+// Field is a single structured key/value pair attached to a log event.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// Fields is an ordered list of structured key/value pairs attached to a log
+// event.
+type Fields []Field
+
+// MakeFields turns a list of alternating keys and values into Fields. Keys
+// that aren't strings are formatted with fmt.Sprint. If there is an odd
+// number of arguments, the final value is kept with an empty value.
+func MakeFields(keyvals ...interface{}) Fields {
+	if len(keyvals) == 0 {
+		return nil
+	}
+	fields := make(Fields, 0, (len(keyvals)+1)/2)
+	for i := 0; i < len(keyvals); i += 2 {
+		key, ok := keyvals[i].(string)
+		if !ok {
+			key = fmt.Sprint(keyvals[i])
+		}
+		var value interface{}
+		if i+1 < len(keyvals) {
+			value = keyvals[i+1]
+		}
+		fields = append(fields, Field{Key: key, Value: value})
+	}
+	return fields
+}
+
+// Get returns the value of the last field with the given key, and whether
+// such a field exists.
+func (f Fields) Get(key string) (value interface{}, ok bool) {
+	for i := len(f) - 1; i >= 0; i-- {
+		if f[i].Key == key {
+			return f[i].Value, true
+		}
+	}
+	return nil, false
+}
+
+// String formats the fields as space-separated key=value pairs, quoting
+// values where necessary.
+func (f Fields) String() string {
+	var buf bytes.Buffer
+	for i, field := range f {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(quoteFieldString(field.Key))
+		buf.WriteByte('=')
+		buf.WriteString(quoteFieldString(formatFieldValue(field.Value)))
+	}
+	return buf.String()
+}
+
+// concat returns a new Fields containing f followed by more, without
+// modifying f.
+func (f Fields) concat(more Fields) Fields {
+	if len(more) == 0 {
+		return f
+	}
+	if len(f) == 0 {
+		return more
+	}
+	rv := make(Fields, 0, len(f)+len(more))
+	return append(append(rv, f...), more...)
+}
+
+func formatFieldValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	}
+	return fmt.Sprint(value)
+}
+
+// quoteFieldString quotes s if it is empty or contains characters that would
+// make a key=value pair ambiguous.
+func quoteFieldString(s string) string {
+	if s == "" {
+		return `""`
+	}
+	for _, r := range s {
+		if r <= ' ' || r == '=' || r == '"' || r == '\\' || r == 0x7f ||
+			r == utf8.RuneError {
+			return strconv.Quote(s)
+		}
+	}
+	return s
+}
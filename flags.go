@@ -0,0 +1,106 @@
+// Copyright (C) 2017 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spacelog
+
+import (
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// FlagSet is the part of a flag set that RegisterFlags needs. It is
+// implemented by *flag.FlagSet from the standard library and by
+// *pflag.FlagSet from github.com/spf13/pflag.
+type FlagSet interface {
+	StringVar(p *string, name string, value string, usage string)
+	IntVar(p *int, name string, value int, usage string)
+	Int64Var(p *int64, name string, value int64, usage string)
+	BoolVar(p *bool, name string, value bool, usage string)
+}
+
+// RegisterFlags registers a flag on fs for each SetupConfig field and returns
+// the SetupConfig the flags will fill in when fs is parsed. Flag names are
+// the field names in lower case with words separated by dashes, after prefix
+// and a dot, such as log.level or log.rotate-size. If prefix is empty, the
+// names have no prefix.
+//
+// Flags default to the value of their corresponding environment variable (see
+// SetupConfigFromEnv), or their usual default if it is unset, so flags given
+// on the command line take precedence over the environment. If a variable is
+// invalid, every flag is still registered, with the usual default for that
+// one, and the first such error is returned, as Setup in the setup
+// subpackage would.
+//
+// Unlike the setup subpackage, RegisterFlags doesn't need flagfile and
+// doesn't touch any global flag set. For example:
+//
+//	config, err := spacelog.RegisterFlags(flag.CommandLine, "log")
+//	if err != nil {
+//		panic(err)
+//	}
+//	flag.Parse()
+//	spacelog.MustSetup(procname, *config)
+func RegisterFlags(fs FlagSet, prefix string) (*SetupConfig, error) {
+	var env_err error
+	config := new(SetupConfig)
+	defaults := DefaultSetupConfig()
+	env := reflect.ValueOf(&defaults).Elem()
+	v := reflect.ValueOf(config).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		name := flagName(field.Name)
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		def := env.Field(i)
+		if err := setEnvField(def, field.Name); err != nil {
+			if env_err == nil {
+				env_err = err
+			}
+			setSetupField(def, field.Tag.Get("default"))
+		}
+		usage := field.Tag.Get("usage")
+		switch p := v.Field(i).Addr().Interface().(type) {
+		case *string:
+			fs.StringVar(p, name, def.String(), usage)
+		case *int:
+			fs.IntVar(p, name, int(def.Int()), usage)
+		case *int64:
+			fs.Int64Var(p, name, def.Int(), usage)
+		case *bool:
+			fs.BoolVar(p, name, def.Bool(), usage)
+		}
+	}
+	return config, env_err
+}
+
+// flagName returns the flag name RegisterFlags uses for the SetupConfig field
+// with the given name.
+func flagName(field string) string {
+	return strings.ToLower(splitWords(field, '-'))
+}
+
+// splitWords inserts sep between the words of a mixed-case name.
+func splitWords(name string, sep rune) string {
+	var rv []rune
+	runes := []rune(name)
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) && unicode.IsLower(runes[i-1]) {
+			rv = append(rv, sep)
+		}
+		rv = append(rv, r)
+	}
+	return string(rv)
+}
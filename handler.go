@@ -15,6 +15,7 @@
 package spacelog
 
 import (
+	"strings"
 	"text/template"
 )
 
@@ -31,6 +32,38 @@ type Handler interface {
 	SetTextOutput(output TextOutput)
 }
 
+// FieldHandler is an optional interface a Handler may implement to receive
+// structured fields attached to a log event, such as those added with
+// Logger.With. Handlers that don't implement FieldHandler receive the fields
+// formatted onto the end of the message instead.
+type FieldHandler interface {
+	Handler
+
+	// LogFields is called instead of Log for every message that has fields.
+	// calldepth follows the same convention as in Log.
+	LogFields(logger_name string, level LogLevel, msg string, calldepth int,
+		fields Fields)
+}
+
+// logFields passes a log event with fields to handler, using LogFields if
+// handler is a FieldHandler, or appending the fields to the message if not.
+func logFields(handler Handler, logger_name string, level LogLevel,
+	msg string, calldepth int, fields Fields) {
+	if calldepth >= 0 {
+		calldepth++
+	}
+	if len(fields) == 0 {
+		handler.Log(logger_name, level, msg, calldepth)
+		return
+	}
+	if fh, ok := handler.(FieldHandler); ok {
+		fh.LogFields(logger_name, level, msg, calldepth, fields)
+		return
+	}
+	handler.Log(logger_name, level,
+		strings.TrimRight(msg, "\n\r")+" "+fields.String(), calldepth)
+}
+
 // HandlerFunc is a type to make implementation of the Handler interface easier
 type HandlerFunc func(logger_name string, level LogLevel, msg string,
 	calldepth int)
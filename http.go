@@ -0,0 +1,206 @@
+// Copyright (C) 2017 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spacelog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// httpMaxBody limits the size of the request bodies the level handler reads.
+const httpMaxBody = 1 << 20
+
+// NewHTTPLevelHandler returns an http.Handler for viewing and changing the
+// levels of the loggers in a LoggerCollection in a running process. It is
+// meant to be mounted under a prefix, for example:
+//
+//	http.Handle("/loggers/",
+//		http.StripPrefix("/loggers", spacelog.NewHTTPLevelHandler(
+//			spacelog.DefaultLoggerCollection)))
+//
+// It supports the following requests, relative to the mount point:
+//
+//	GET /              lists every logger and its level, one per line
+//	GET /<logger>      shows the level of a single logger
+//	PUT /              applies a ConfigureLoggers specification, or a JSON
+//	                   object of logger names to levels or JSON string
+//	                   holding a specification
+//	PUT /<logger>      sets the level of a single logger, given as level=<level>,
+//	                   a bare level, or a JSON object with a "level" member
+//
+// A specification is applied as ConfigureLoggers would. A JSON object's
+// levels are applied in the order the object lists them, except that DEFAULT,
+// which resets every other logger, is applied first. A PUT to
+// /<logger> responds with the level it applied, even if no logger of that
+// name exists yet or the name is a pattern such as "storage.*".
+//
+// POST is accepted in place of PUT, but only with a Content-Type of
+// application/json, so that a browser can't be tricked into changing levels
+// with a plain form or cross-site request. Request bodies are limited to
+// 1MB. The logger named DEFAULT refers to the collection's default level.
+// Responses are JSON if the request has a format=json query parameter or
+// accepts application/json.
+func NewHTTPLevelHandler(c *LoggerCollection) http.Handler {
+	return &httpLevelHandler{c: c}
+}
+
+type httpLevelHandler struct {
+	c *LoggerCollection
+}
+
+func (h *httpLevelHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.Trim(r.URL.Path, "/")
+	switch r.Method {
+	case "GET", "HEAD":
+	case "PUT", "POST":
+		if r.Method == "POST" && !isJSONRequest(r) {
+			http.Error(w, "POST requires Content-Type: application/json",
+				http.StatusUnsupportedMediaType)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, httpMaxBody)
+		source := "http " + r.RemoteAddr
+		if name != "" {
+			level, err := h.configureLogger(name, r, source)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			h.writeLevels(w, r, []LoggerInfo{{Name: name, Level: level}})
+			return
+		}
+		err := h.configure(r, source)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if name != "" {
+		level, exists := h.c.Level(name)
+		if !exists {
+			http.Error(w, fmt.Sprintf("logger %q not found", name),
+				http.StatusNotFound)
+			return
+		}
+		h.writeLevels(w, r, []LoggerInfo{{Name: name, Level: level}})
+		return
+	}
+	default_level, _ := h.c.Level("DEFAULT")
+	h.writeLevels(w, r, append(
+		[]LoggerInfo{{Name: "DEFAULT", Level: default_level}},
+		h.c.Loggers()...))
+}
+
+// configure applies a specification of several loggers' levels.
+func (h *httpLevelHandler) configure(r *http.Request, source string) error {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	if !isJSONRequest(r) {
+		specs, err := ParseSpecification(string(body))
+		if err != nil {
+			return err
+		}
+		h.c.applyLevelSpecs(specs, source)
+		return nil
+	}
+	var specstr string
+	if json.Unmarshal(body, &specstr) == nil {
+		specs, err := ParseSpecification(specstr)
+		if err != nil {
+			return err
+		}
+		h.c.applyLevelSpecs(specs, source)
+		return nil
+	}
+	// decode the object in order, as patterns can overlap
+	table, err := parseSetupJSON(body)
+	if err != nil {
+		return err
+	}
+	specs := make([]LevelSpec, 0, len(table.keys))
+	for _, name := range table.keys {
+		levelstr, ok := table.values[name].(string)
+		if !ok {
+			return fmt.Errorf("level for %q must be a string", name)
+		}
+		level, err := LevelFromString(strings.TrimSpace(levelstr))
+		if err != nil {
+			return err
+		}
+		specs = append(specs, LevelSpec{Name: name, Level: level})
+	}
+	h.c.applyLevelSpecs(defaultFirst(specs), source)
+	return nil
+}
+
+// configureLogger sets a single logger's level, returning the level set.
+func (h *httpLevelHandler) configureLogger(name string, r *http.Request,
+	source string) (level LogLevel, err error) {
+	var levelstr string
+	if isJSONRequest(r) {
+		var spec struct {
+			Level string `json:"level"`
+		}
+		err = json.NewDecoder(r.Body).Decode(&spec)
+		if err != nil {
+			return 0, err
+		}
+		levelstr = spec.Level
+	} else if levelstr = r.URL.Query().Get("level"); levelstr == "" {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return 0, err
+		}
+		levelstr = strings.TrimSpace(string(body))
+		levelstr = strings.TrimPrefix(levelstr, "level=")
+	}
+	level, err = LevelFromString(strings.TrimSpace(levelstr))
+	if err != nil {
+		return 0, err
+	}
+	h.c.applyLevelSpecs([]LevelSpec{{Name: name, Level: level}}, source)
+	return level, nil
+}
+
+func (h *httpLevelHandler) writeLevels(w http.ResponseWriter,
+	r *http.Request, infos []LoggerInfo) {
+	if r.URL.Query().Get("format") == "json" ||
+		strings.Contains(r.Header.Get("Accept"), "application/json") {
+		out := make(map[string]string, len(infos))
+		for _, info := range infos {
+			out[info.Name] = info.Level.specString()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for _, info := range infos {
+		fmt.Fprintf(w, "%s=%s\n", info.Name, info.Level.specString())
+	}
+}
+
+func isJSONRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("Content-Type"), "application/json")
+}
@@ -0,0 +1,102 @@
+// Copyright (C) 2017 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spacelog
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func serveLevels(c *LoggerCollection, method, content_type,
+	body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, "/", strings.NewReader(body))
+	if content_type != "" {
+		r.Header.Set("Content-Type", content_type)
+	}
+	w := httptest.NewRecorder()
+	NewHTTPLevelHandler(c).ServeHTTP(w, r)
+	return w
+}
+
+func TestHTTPLevelHandlerOrder(t *testing.T) {
+	for _, test := range []struct {
+		method       string
+		content_type string
+		body         string
+		want         LogLevel
+	}{
+		{"PUT", "application/json",
+			`{"*.rpc": "trace", "storage.*": "debug", "DEFAULT": "error"}`,
+			Debug},
+		{"PUT", "application/json",
+			`{"storage.*": "debug", "*.rpc": "trace", "DEFAULT": "error"}`,
+			Trace},
+		{"POST", "application/json",
+			`{"storage.*": "debug", "*.rpc": "trace"}`, Trace},
+		{"PUT", "application/json", `"*.rpc=trace; storage.*=debug"`, Debug},
+		{"PUT", "text/plain", "storage.*=debug\n*.rpc=trace\n", Trace},
+		{"PUT", "", "*.rpc=trace,storage.*=debug", Debug},
+	} {
+		c := NewLoggerCollection()
+		logger := c.GetLoggerNamed("storage.rpc")
+		w := serveLevels(c, test.method, test.content_type, test.body)
+		if w.Code != http.StatusOK {
+			t.Errorf("%s %q: got status %d: %s", test.method, test.body,
+				w.Code, w.Body)
+			continue
+		}
+		if level := logger.Level(); level != test.want {
+			t.Errorf("%s %q: got level %s, want %s", test.method, test.body,
+				level, test.want)
+		}
+	}
+}
+
+func TestHTTPLevelHandlerRejects(t *testing.T) {
+	for _, test := range []struct {
+		method       string
+		content_type string
+		body         string
+		status       int
+	}{
+		{"POST", "", "storage=debug", http.StatusUnsupportedMediaType},
+		{"POST", "text/plain", "storage=debug",
+			http.StatusUnsupportedMediaType},
+		{"POST", "application/x-www-form-urlencoded", "storage=debug",
+			http.StatusUnsupportedMediaType},
+		{"PUT", "application/json", `{"storage": 1}`, http.StatusBadRequest},
+		{"PUT", "application/json", `{"storage": "loud"}`,
+			http.StatusBadRequest},
+		{"PUT", "text/plain",
+			"storage=debug\n" + strings.Repeat("#", httpMaxBody),
+			http.StatusBadRequest},
+		{"DELETE", "", "", http.StatusMethodNotAllowed},
+	} {
+		c := NewLoggerCollection()
+		logger := c.GetLoggerNamed("storage")
+		before := logger.Level()
+		w := serveLevels(c, test.method, test.content_type, test.body)
+		if w.Code != test.status {
+			t.Errorf("%s %s %.40q: got status %d, want %d", test.method,
+				test.content_type, test.body, w.Code, test.status)
+		}
+		if level := logger.Level(); level != before {
+			t.Errorf("%s %s %.40q: level changed to %s", test.method,
+				test.content_type, test.body, level)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright (C) 2017 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spacelog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// JSONHandler is a Handler that writes each log event as a single JSON
+// object to a configured TextOutput. The object has the keys "timestamp",
+// "level", "logger", "file", "line", "message", and, if the event has any
+// structured fields, "fields".
+type JSONHandler struct {
+	mtx    sync.RWMutex
+	output TextOutput
+	health outputHealth
+}
+
+// NewJSONHandler creates a Handler that writes log events as JSON objects to
+// output.
+func NewJSONHandler(output TextOutput) *JSONHandler {
+	return &JSONHandler{output: output}
+}
+
+type jsonEvent struct {
+	Timestamp string     `json:"timestamp"`
+	Level     string     `json:"level"`
+	Logger    string     `json:"logger"`
+	File      string     `json:"file,omitempty"`
+	Line      int        `json:"line,omitempty"`
+	Message   string     `json:"message"`
+	Fields    jsonFields `json:"fields,omitempty"`
+}
+
+// Log formats the log event as JSON and passes it to the configured output
+// sink
+func (h *JSONHandler) Log(logger_name string, level LogLevel, msg string,
+	calldepth int) {
+	if calldepth >= 0 {
+		calldepth++
+	}
+	h.LogFields(logger_name, level, msg, calldepth, nil)
+}
+
+// LogFields is like Log, but includes the given fields in the JSON object.
+func (h *JSONHandler) LogFields(logger_name string, level LogLevel,
+	msg string, calldepth int, fields Fields) {
+	h.mtx.RLock()
+	output := h.output
+	h.mtx.RUnlock()
+	event := jsonEvent{
+		Timestamp: time.Now().Format(time.RFC3339Nano),
+		Level:     level.Name(),
+		Logger:    logger_name,
+		Message:   strings.TrimRight(msg, "\n\r"),
+		Fields:    jsonFields(fields)}
+	if calldepth >= 0 {
+		_, event.File, event.Line, _ = runtime.Caller(calldepth + 1)
+	}
+	data, err := json.Marshal(&event)
+	if err != nil {
+		h.health.failed(err)
+		output.Output(level, []byte(
+			fmt.Sprintf("log json encoding failed: %s", err)))
+		return
+	}
+	output.Output(level, data)
+}
+
+// SetTextTemplate is a no-op
+func (h *JSONHandler) SetTextTemplate(t *template.Template) {}
+
+// SetTextOutput changes the JSONHandler's TextOutput sink
+func (h *JSONHandler) SetTextOutput(output TextOutput) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	h.output = output
+}
+
+// Stats reports the JSONHandler's formatting errors. What its TextOutput
+// sink writes is in the sink's own Stats.
+func (h *JSONHandler) Stats() OutputStats {
+	return h.health.Stats()
+}
+
+// SetErrorHandler registers fn to be called with each formatting error
+func (h *JSONHandler) SetErrorHandler(fn func(error)) {
+	h.health.SetErrorHandler(fn)
+}
+
+func (h *JSONHandler) logChildren() []interface{} {
+	h.mtx.RLock()
+	defer h.mtx.RUnlock()
+	return []interface{}{h.output}
+}
+
+// Flush flushes the JSONHandler's TextOutput sink
+func (h *JSONHandler) Flush() error {
+	h.mtx.RLock()
+	output := h.output
+	h.mtx.RUnlock()
+	return flushValue(output)
+}
+
+// Close flushes and closes the JSONHandler's TextOutput sink
+func (h *JSONHandler) Close() error {
+	h.mtx.RLock()
+	output := h.output
+	h.mtx.RUnlock()
+	return closeValue(output)
+}
+
+// jsonFields marshals Fields as a JSON object, preserving field order. If a
+// key is repeated, the last value wins.
+type jsonFields Fields
+
+func (f jsonFields) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	first := true
+	for i, field := range f {
+		if jsonFieldOverridden(f[i+1:], field.Key) {
+			continue
+		}
+		if !first {
+			buf.WriteByte(',')
+		}
+		first = false
+		key, err := json.Marshal(field.Key)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(jsonFieldValue(field.Value))
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func jsonFieldOverridden(rest jsonFields, key string) bool {
+	for _, field := range rest {
+		if field.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonFieldValue encodes a field value. Errors are encoded as their message,
+// and values that can't be encoded as JSON are encoded as their fmt.Sprint
+// representation.
+func jsonFieldValue(value interface{}) []byte {
+	if err, ok := value.(error); ok {
+		value = err.Error()
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(value))
+	}
+	return data
+}
@@ -134,3 +134,12 @@ func LevelFromString(str string) (LogLevel, error) {
 	}
 	return 0, fmt.Errorf("Invalid log level: %s", str)
 }
+
+// specString returns the level in a form LevelFromString understands,
+// preferring the long name if the level is exactly a named level.
+func (l LogLevel) specString() string {
+	if l.Match() == l && l != 0 {
+		return l.Name()
+	}
+	return strconv.FormatInt(int64(l), 10)
+}
@@ -0,0 +1,159 @@
+// Copyright (C) 2017 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spacelog
+
+import (
+	"io"
+	"os"
+	"os/signal"
+	"reflect"
+	"time"
+)
+
+// Flusher is an optional interface for Handlers and TextOutputs that hold on
+// to log events before writing them out. Flush writes out anything pending,
+// waiting until it is written, and syncs files to stable storage.
+//
+// Handlers and TextOutputs may also implement io.Closer, to flush and then
+// release their resources. Closing a Handler closes its outputs. Close may be
+// called more than once, as several Handlers may share an output.
+type Flusher interface {
+	Flush() error
+}
+
+// flushValue flushes v if it is a Flusher.
+func flushValue(v interface{}) error {
+	if f, ok := v.(Flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// closeValue closes v if it has a Close method, with or without an error
+// result.
+func closeValue(v interface{}) error {
+	switch c := v.(type) {
+	case io.Closer:
+		return c.Close()
+	case interface {
+		Close()
+	}:
+		c.Close()
+	}
+	return nil
+}
+
+// Flush flushes every Handler in use by the collection's loggers, and their
+// outputs, returning the first error encountered.
+func (c *LoggerCollection) Flush() (err error) {
+	for _, handler := range c.handlers() {
+		if ferr := flushValue(handler); err == nil {
+			err = ferr
+		}
+	}
+	return err
+}
+
+// Close flushes and closes every Handler in use by the collection's loggers,
+// and their outputs, returning the first error encountered. Loggers keep
+// their Handlers, so log events after Close go to closed outputs, which
+// handle them as best they can.
+func (c *LoggerCollection) Close() (err error) {
+	for _, handler := range c.handlers() {
+		if cerr := closeValue(handler); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// handlers returns each distinct Handler in use by the collection.
+func (c *LoggerCollection) handlers() []Handler {
+	c.mtx.Lock()
+	all := make([]Handler, 0, len(c.loggers)+1)
+	if c.handler != nil {
+		all = append(all, c.handler)
+	}
+	for _, logger := range c.loggers {
+		all = append(all, logger.getHandler())
+	}
+	c.mtx.Unlock()
+	seen := make(map[Handler]bool, len(all))
+	handlers := make([]Handler, 0, len(all))
+	for _, handler := range all {
+		if reflect.TypeOf(handler).Comparable() {
+			if seen[handler] {
+				continue
+			}
+			seen[handler] = true
+		}
+		handlers = append(handlers, handler)
+	}
+	return handlers
+}
+
+// Flush flushes every Handler in use by the default collection.
+func Flush() error {
+	return DefaultLoggerCollection.Flush()
+}
+
+// Close flushes and closes every Handler in use by the default collection.
+func Close() error {
+	return DefaultLoggerCollection.Close()
+}
+
+// Exit closes the default collection, so that buffered log events are
+// written out, and then exits the process with the given status code. Use it
+// in place of os.Exit.
+func Exit(code int) {
+	Close()
+	os.Exit(code)
+}
+
+// closeSignalTimeout is how long CloseOnSignal waits for Close.
+const closeSignalTimeout = 5 * time.Second
+
+// CloseOnSignal closes the default collection when the process receives one
+// of sigs, or an interrupt or termination signal if sigs is empty. It stops
+// handling the signals first, so a second signal stops the process even if
+// closing hangs, and it waits at most five seconds for Close. It then sends
+// the signal to the process again, so the process dies as it would have
+// without CloseOnSignal. Where that isn't possible, it exits the process with
+// status 1.
+func CloseOnSignal(sigs ...os.Signal) {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{os.Interrupt, sigTERM}
+	}
+	sigchan := make(chan os.Signal, 1)
+	signal.Notify(sigchan, sigs...)
+	go func() {
+		sig := <-sigchan
+		signal.Reset(sigs...)
+		closed := make(chan struct{})
+		go func() {
+			Close()
+			close(closed)
+		}()
+		select {
+		case <-closed:
+		case <-time.After(closeSignalTimeout):
+		}
+		if p, err := os.FindProcess(os.Getpid()); err == nil &&
+			p.Signal(sig) == nil {
+			time.Sleep(time.Second)
+		}
+		os.Exit(1)
+	}()
+}
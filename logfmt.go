@@ -0,0 +1,274 @@
+// Copyright (C) 2017 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spacelog
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// LogfmtHandler is a Handler that writes each log event as a single line of
+// logfmt-style key=value pairs to a configured TextOutput. The line starts
+// with the keys "time", "level", "logger", "file", "line" and "msg", followed
+// by any structured fields, which may reuse those keys. Values are quoted and
+// escaped when necessary, so the output can be read back with ParseLogfmt.
+type LogfmtHandler struct {
+	mtx    sync.RWMutex
+	output TextOutput
+}
+
+// NewLogfmtHandler creates a Handler that writes log events as logfmt lines
+// to output.
+func NewLogfmtHandler(output TextOutput) *LogfmtHandler {
+	return &LogfmtHandler{output: output}
+}
+
+// Log formats the log event as logfmt and passes it to the configured output
+// sink
+func (h *LogfmtHandler) Log(logger_name string, level LogLevel, msg string,
+	calldepth int) {
+	if calldepth >= 0 {
+		calldepth++
+	}
+	h.LogFields(logger_name, level, msg, calldepth, nil)
+}
+
+// LogFields is like Log, but appends the given fields to the logfmt line.
+func (h *LogfmtHandler) LogFields(logger_name string, level LogLevel,
+	msg string, calldepth int, fields Fields) {
+	h.mtx.RLock()
+	output := h.output
+	h.mtx.RUnlock()
+	event := Fields{
+		{Key: "time", Value: time.Now().Format(time.RFC3339Nano)},
+		{Key: "level", Value: level.specString()},
+		{Key: "logger", Value: logger_name}}
+	if calldepth >= 0 {
+		_, file, line, ok := runtime.Caller(calldepth + 1)
+		if ok {
+			event = append(event, Field{Key: "file", Value: file},
+				Field{Key: "line", Value: line})
+		}
+	}
+	event = append(event, Field{Key: "msg",
+		Value: strings.TrimRight(msg, "\n\r")})
+	output.Output(level, []byte(event.concat(fields).String()))
+}
+
+// SetTextTemplate is a no-op
+func (h *LogfmtHandler) SetTextTemplate(t *template.Template) {}
+
+// SetTextOutput changes the LogfmtHandler's TextOutput sink
+func (h *LogfmtHandler) SetTextOutput(output TextOutput) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	h.output = output
+}
+
+func (h *LogfmtHandler) logChildren() []interface{} {
+	h.mtx.RLock()
+	defer h.mtx.RUnlock()
+	return []interface{}{h.output}
+}
+
+// Flush flushes the LogfmtHandler's TextOutput sink
+func (h *LogfmtHandler) Flush() error {
+	h.mtx.RLock()
+	output := h.output
+	h.mtx.RUnlock()
+	return flushValue(output)
+}
+
+// Close flushes and closes the LogfmtHandler's TextOutput sink
+func (h *LogfmtHandler) Close() error {
+	h.mtx.RLock()
+	output := h.output
+	h.mtx.RUnlock()
+	return closeValue(output)
+}
+
+// LogfmtSyntaxError is returned by ParseLogfmt when a line can't be parsed.
+// Column is the byte offset into the line, starting at 1.
+type LogfmtSyntaxError struct {
+	Column int
+	Msg    string
+}
+
+func (e *LogfmtSyntaxError) Error() string {
+	return fmt.Sprintf("logfmt: %s at column %d", e.Msg, e.Column)
+}
+
+// ParseLogfmtFields parses a line of logfmt key=value pairs into Fields, in
+// the order they appear. Values may be bare or double-quoted with Go string
+// escapes. A key without a value is given an empty value. All values are
+// strings.
+func ParseLogfmtFields(line string) (Fields, error) {
+	var fields Fields
+	pos := 0
+	for {
+		for pos < len(line) && line[pos] <= ' ' {
+			pos++
+		}
+		if pos >= len(line) {
+			return fields, nil
+		}
+		key, next, err := parseLogfmtToken(line, pos, true)
+		if err != nil {
+			return nil, err
+		}
+		if next == pos {
+			return nil, &LogfmtSyntaxError{Column: pos + 1, Msg: "empty key"}
+		}
+		pos = next
+		var value string
+		if pos < len(line) && line[pos] == '=' {
+			value, pos, err = parseLogfmtToken(line, pos+1, false)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if pos < len(line) && line[pos] > ' ' {
+			return nil, &LogfmtSyntaxError{Column: pos + 1,
+				Msg: fmt.Sprintf("unexpected %q", line[pos])}
+		}
+		fields = append(fields, Field{Key: key, Value: value})
+	}
+}
+
+// parseLogfmtToken parses a bare or quoted token starting at pos, returning
+// the token and the position just after it. Bare keys end at '='.
+func parseLogfmtToken(line string, pos int, key bool) (
+	token string, next int, err error) {
+	if pos < len(line) && line[pos] == '"' {
+		end := pos + 1
+		for ; end < len(line); end++ {
+			if line[end] == '\\' {
+				end++
+				continue
+			}
+			if line[end] == '"' {
+				break
+			}
+		}
+		if end >= len(line) {
+			return "", 0, &LogfmtSyntaxError{Column: pos + 1,
+				Msg: "unterminated quoted string"}
+		}
+		token, err = strconv.Unquote(line[pos : end+1])
+		if err != nil {
+			return "", 0, &LogfmtSyntaxError{Column: pos + 1,
+				Msg: "invalid quoted string"}
+		}
+		return token, end + 1, nil
+	}
+	end := pos
+	for end < len(line) && line[end] > ' ' && line[end] != '"' &&
+		!(key && line[end] == '=') {
+		end++
+	}
+	return line[pos:end], end, nil
+}
+
+// logfmtHeader lists the keys LogfmtHandler starts each line with, in order.
+// "file" and "line" are left out when the caller isn't known.
+var logfmtHeader = []string{"time", "level", "logger", "file", "line", "msg"}
+
+// ParseLogfmt parses a line as written by LogfmtHandler back into a LogEvent.
+// The "time", "level", "logger", "file", "line" and "msg" keys at the start
+// of the line, in that order, fill in the corresponding LogEvent members.
+// All keys after them, including structured fields that reuse those names,
+// become Fields with string values.
+func ParseLogfmt(line string) (*LogEvent, error) {
+	fields, err := ParseLogfmtFields(line)
+	if err != nil {
+		return nil, err
+	}
+	event := &LogEvent{}
+	header := logfmtHeader
+	for _, field := range fields {
+		value := field.Value.(string)
+		key := ""
+		for i, name := range header {
+			if name == field.Key {
+				key, header = name, header[i+1:]
+				break
+			}
+		}
+		if key == "" {
+			header = nil
+		}
+		switch key {
+		case "time":
+			event.Timestamp, err = time.Parse(time.RFC3339Nano, value)
+		case "level":
+			event.Level, err = LevelFromString(value)
+		case "logger":
+			event.LoggerName = value
+		case "file":
+			event.Filepath = value
+		case "line":
+			event.Line, err = strconv.Atoi(value)
+		case "msg":
+			event.Message = value
+		default:
+			event.Fields = append(event.Fields, field)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("logfmt: invalid %s: %s", field.Key, err)
+		}
+	}
+	return event, nil
+}
+
+// LogfmtDecoder reads LogEvents from a stream of logfmt lines, such as a log
+// file written with LogfmtHandler.
+type LogfmtDecoder struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+// NewLogfmtDecoder returns a LogfmtDecoder reading from r.
+func NewLogfmtDecoder(r io.Reader) *LogfmtDecoder {
+	return &LogfmtDecoder{scanner: bufio.NewScanner(r)}
+}
+
+// Decode returns the next LogEvent in the stream, skipping blank lines. It
+// returns io.EOF when the stream is exhausted.
+func (d *LogfmtDecoder) Decode() (*LogEvent, error) {
+	for d.scanner.Scan() {
+		d.line++
+		line := bytes.TrimSpace(d.scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		event, err := ParseLogfmt(string(line))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", d.line, err)
+		}
+		return event, nil
+	}
+	if err := d.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
@@ -0,0 +1,150 @@
+// Copyright (C) 2017 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spacelog
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestLogfmtRoundTrip(t *testing.T) {
+	levels := []LogLevel{0, Trace - 1, Trace, Debug, Info, Notice, 43,
+		Warning, Error, Critical, Critical + 5}
+	messages := []string{"hello", "", "two words", `quote " and \ slash`,
+		"key=value", "tab\there", "unicode ☃", "trailing newline\n"}
+	fields := Fields{
+		{Key: "request_id", Value: "abc 123"},
+		{Key: "count", Value: 3},
+		{Key: "empty", Value: ""}}
+
+	for _, level := range levels {
+		for _, msg := range messages {
+			var buf bytes.Buffer
+			h := NewLogfmtHandler(NewWriterOutput(&buf))
+			h.LogFields("some.logger", level, msg, -1, fields)
+
+			event, err := ParseLogfmt(strings.TrimRight(buf.String(), "\n"))
+			if err != nil {
+				t.Fatalf("level %d, msg %q: parsing %q: %s",
+					level, msg, buf.String(), err)
+			}
+			if event.Level != level {
+				t.Errorf("level %d: got level %d back", level, event.Level)
+			}
+			if event.LoggerName != "some.logger" {
+				t.Errorf("level %d: got logger %q back", level, event.LoggerName)
+			}
+			if want := strings.TrimRight(msg, "\n"); event.Message != want {
+				t.Errorf("level %d: got msg %q back, want %q",
+					level, event.Message, want)
+			}
+			if event.Timestamp.IsZero() {
+				t.Errorf("level %d: no timestamp", level)
+			}
+			if got, want := event.Fields.String(), (Fields{
+				{Key: "request_id", Value: "abc 123"},
+				{Key: "count", Value: "3"},
+				{Key: "empty", Value: ""}}).String(); got != want {
+				t.Errorf("level %d: got fields %s back, want %s",
+					level, got, want)
+			}
+		}
+	}
+}
+
+func TestLogfmtDecoder(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewLogfmtHandler(NewWriterOutput(&buf))
+	h.Log("a", Info, "first", 0)
+	h.Log("b", 0, "second", -1)
+	h.Log("c", Warning+3, "third", -1)
+
+	d := NewLogfmtDecoder(&buf)
+	var events []*LogEvent
+	for {
+		event, err := d.Decode()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, event)
+	}
+	if len(events) != 3 {
+		t.Fatalf("got %d events, want 3", len(events))
+	}
+	if !strings.HasSuffix(events[0].Filepath, "logfmt_test.go") ||
+		events[0].Line == 0 {
+		t.Errorf("got caller %s:%d", events[0].Filepath, events[0].Line)
+	}
+	for i, want := range []LogLevel{Info, 0, Warning + 3} {
+		if events[i].Level != want {
+			t.Errorf("event %d: got level %d, want %d", i, events[i].Level, want)
+		}
+	}
+}
+
+func TestParseLogfmtErrors(t *testing.T) {
+	for _, line := range []string{
+		`level=bogus`,
+		`line=abc`,
+		`time=yesterday`,
+		`msg="unterminated`,
+	} {
+		if _, err := ParseLogfmt(line); err == nil {
+			t.Errorf("ParseLogfmt(%q) succeeded", line)
+		}
+	}
+}
+
+func TestLogfmtReservedFieldNames(t *testing.T) {
+	fields := Fields{
+		{Key: "level", Value: "high"},
+		{Key: "msg", Value: "not the message"},
+		{Key: "time", Value: "noon"},
+		{Key: "logger", Value: "other"},
+		{Key: "file", Value: "elsewhere.go"},
+		{Key: "line", Value: "abc"}}
+
+	for _, calldepth := range []int{0, -1} {
+		var buf bytes.Buffer
+		h := NewLogfmtHandler(NewWriterOutput(&buf))
+		h.LogFields("some.logger", Warning, "the message", calldepth, fields)
+
+		event, err := ParseLogfmt(strings.TrimRight(buf.String(), "\n"))
+		if err != nil {
+			t.Fatalf("calldepth %d: parsing %q: %s", calldepth, buf.String(), err)
+		}
+		if event.Level != Warning || event.LoggerName != "some.logger" ||
+			event.Message != "the message" || event.Timestamp.IsZero() {
+			t.Errorf("calldepth %d: got header %d %q %q %v", calldepth,
+				event.Level, event.LoggerName, event.Message, event.Timestamp)
+		}
+		if calldepth >= 0 && !strings.HasSuffix(event.Filepath, "logfmt_test.go") {
+			t.Errorf("calldepth %d: got file %q", calldepth, event.Filepath)
+		}
+		if calldepth < 0 && (event.Filepath != "" || event.Line != 0) {
+			t.Errorf("calldepth %d: got caller %s:%d", calldepth,
+				event.Filepath, event.Line)
+		}
+		if got, want := event.Fields.String(), fields.String(); got != want {
+			t.Errorf("calldepth %d: got fields %s back, want %s",
+				calldepth, got, want)
+		}
+	}
+}
@@ -15,6 +15,7 @@
 package spacelog
 
 import (
+	"context"
 	"sync"
 	"sync/atomic"
 )
@@ -24,6 +25,9 @@ import (
 // GetLogger, GetLoggerNamed, or another Logger's Scope method. A logger also
 // has an associated level and handler, typically configured through the logger
 // collection to which it belongs.
+//
+// A Logger may also carry structured fields, added with With. Such a Logger
+// shares its level and handler with the Logger it was derived from.
 type Logger struct {
 	level      LogLevel
 	name       string
@@ -31,13 +35,65 @@ type Logger struct {
 
 	handler_mtx sync.RWMutex
 	handler     Handler
+
+	// base is the collection-owned Logger this Logger was derived from via
+	// With, or nil if this Logger is owned by the collection.
+	base   *Logger
+	fields Fields
+
+	// escalated is set on derived Loggers whose level has been lowered to
+	// escalation for a single context, via WithContext.
+	escalated  bool
+	escalation LogLevel
+
+	// ctx is the context whose fields were attached via WithContext, if any.
+	ctx context.Context
 }
 
-// Scope returns a new Logger with the same level and handler, using the
-// receiver Logger's name as a prefix.
+// Scope returns a new Logger with the same handler, using the receiver
+// Logger's name as a prefix. Unless configured otherwise, the new Logger
+// inherits the receiver's level. Any fields attached to the receiver are
+// carried over.
 func (l *Logger) Scope(name string) *Logger {
-	return l.collection.getLogger(l.name+"."+name, l.getLevel(),
-		l.getHandler())
+	scoped := l.collection.getLogger(l.name+"."+name, l.getHandler())
+	if len(l.fields) == 0 && !l.escalated {
+		return scoped
+	}
+	return &Logger{name: scoped.name, collection: l.collection,
+		base: scoped, fields: l.fields,
+		escalated: l.escalated, escalation: l.escalation, ctx: l.ctx}
+}
+
+// Name returns the name of the logger.
+func (l *Logger) Name() string {
+	return l.name
+}
+
+// Level returns the current level of the logger.
+func (l *Logger) Level() LogLevel {
+	return l.getLevel()
+}
+
+// With returns a new Logger that attaches the given alternating keys and
+// values as structured fields to every log event. The new Logger shares the
+// receiver's name, level and handler. Fields from the receiver are kept, and
+// new fields are appended after them.
+func (l *Logger) With(keyvals ...interface{}) *Logger {
+	return &Logger{name: l.name, collection: l.collection,
+		base: l.root(), fields: l.fields.concat(MakeFields(keyvals...)),
+		escalated: l.escalated, escalation: l.escalation, ctx: l.ctx}
+}
+
+// Fields returns the structured fields attached to this Logger.
+func (l *Logger) Fields() Fields {
+	return l.fields
+}
+
+func (l *Logger) root() *Logger {
+	if l.base != nil {
+		return l.base
+	}
+	return l
 }
 
 func (l *Logger) setLevel(level LogLevel) {
@@ -45,6 +101,13 @@ func (l *Logger) setLevel(level LogLevel) {
 }
 
 func (l *Logger) getLevel() LogLevel {
+	if l.base != nil {
+		level := l.base.getLevel()
+		if l.escalated && l.escalation < level {
+			return l.escalation
+		}
+		return level
+	}
 	return LogLevel(atomic.LoadInt32((*int32)(&l.level)))
 }
 
@@ -55,7 +118,23 @@ func (l *Logger) setHandler(handler Handler) {
 }
 
 func (l *Logger) getHandler() Handler {
+	if l.base != nil {
+		return l.base.getHandler()
+	}
 	l.handler_mtx.RLock()
 	defer l.handler_mtx.RUnlock()
 	return l.handler
 }
+
+// output passes a log event on to the logger's handler, along with any
+// fields. calldepth follows the same convention as Handler.Log, relative to
+// the caller of output.
+func (l *Logger) output(level LogLevel, msg string, calldepth int,
+	fields Fields) {
+	handler := l.getHandler()
+	fields = l.fields.concat(fields)
+	if calldepth >= 0 {
+		calldepth++
+	}
+	logFields(handler, l.name, level, msg, calldepth, fields)
+}
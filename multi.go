@@ -0,0 +1,179 @@
+// Copyright (C) 2017 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spacelog
+
+import (
+	"text/template"
+)
+
+// LeveledHandler is a Handler that only receives log events at or above
+// Level, for use with MultiHandler.
+type LeveledHandler struct {
+	Handler Handler
+	Level   LogLevel
+}
+
+// MultiHandler is a Handler that passes each log event to several child
+// Handlers, skipping children whose Level is above the event's level. Note
+// that a logger's own level still applies first, so a child only sees events
+// that are enabled on the logger as well.
+type MultiHandler struct {
+	children []LeveledHandler
+}
+
+// NewMultiHandler creates a Handler that dispatches log events to each of
+// children.
+func NewMultiHandler(children ...LeveledHandler) *MultiHandler {
+	return &MultiHandler{
+		children: append([]LeveledHandler(nil), children...)}
+}
+
+// Log passes the log event to each child whose level allows it
+func (m *MultiHandler) Log(logger_name string, level LogLevel, msg string,
+	calldepth int) {
+	if calldepth >= 0 {
+		calldepth++
+	}
+	for _, child := range m.children {
+		if level >= child.Level {
+			child.Handler.Log(logger_name, level, msg, calldepth)
+		}
+	}
+}
+
+// LogFields is like Log, but passes fields on to children that are
+// FieldHandlers, and formats them onto the message for children that aren't.
+func (m *MultiHandler) LogFields(logger_name string, level LogLevel,
+	msg string, calldepth int, fields Fields) {
+	if calldepth >= 0 {
+		calldepth++
+	}
+	for _, child := range m.children {
+		if level >= child.Level {
+			logFields(child.Handler, logger_name, level, msg, calldepth, fields)
+		}
+	}
+}
+
+// SetTextTemplate is a no-op, as each child has its own template
+func (m *MultiHandler) SetTextTemplate(t *template.Template) {}
+
+// SetTextOutput is a no-op, as each child has its own output
+func (m *MultiHandler) SetTextOutput(output TextOutput) {}
+
+// Flush flushes each child, returning the first error encountered
+func (m *MultiHandler) Flush() (err error) {
+	for _, child := range m.children {
+		if ferr := flushValue(child.Handler); err == nil {
+			err = ferr
+		}
+	}
+	return err
+}
+
+// Close closes each child, returning the first error encountered
+func (m *MultiHandler) Close() (err error) {
+	for _, child := range m.children {
+		if cerr := closeValue(child.Handler); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func (m *MultiHandler) logChildren() []interface{} {
+	children := make([]interface{}, 0, len(m.children))
+	for _, child := range m.children {
+		children = append(children, child.Handler)
+	}
+	return children
+}
+
+// Children returns the MultiHandler's child Handlers.
+func (m *MultiHandler) Children() []LeveledHandler {
+	return append([]LeveledHandler(nil), m.children...)
+}
+
+// LeveledOutput is a TextOutput that only receives messages at or above
+// Level, for use with MultiOutput.
+type LeveledOutput struct {
+	Output TextOutput
+	Level  LogLevel
+}
+
+// MultiOutput is a TextOutput that writes each message to several child
+// TextOutputs, skipping children whose Level is above the message's level.
+// Unlike MultiHandler, every child gets the same formatted message.
+type MultiOutput struct {
+	children []LeveledOutput
+}
+
+// NewMultiOutput creates a TextOutput that writes messages to each of
+// children.
+func NewMultiOutput(children ...LeveledOutput) *MultiOutput {
+	return &MultiOutput{
+		children: append([]LeveledOutput(nil), children...)}
+}
+
+// Output writes the message to each child whose level allows it
+func (m *MultiOutput) Output(level LogLevel, message []byte) {
+	for _, child := range m.children {
+		if level >= child.Level {
+			child.Output.Output(level, message)
+		}
+	}
+}
+
+// OnHup passes the HUP on to each child that handles it
+func (m *MultiOutput) OnHup() {
+	for _, child := range m.children {
+		if hh, ok := child.Output.(HupHandlingTextOutput); ok {
+			hh.OnHup()
+		}
+	}
+}
+
+// Flush flushes each child, returning the first error encountered
+func (m *MultiOutput) Flush() (err error) {
+	for _, child := range m.children {
+		if ferr := flushValue(child.Output); err == nil {
+			err = ferr
+		}
+	}
+	return err
+}
+
+// Close closes each child, returning the first error encountered
+func (m *MultiOutput) Close() (err error) {
+	for _, child := range m.children {
+		if cerr := closeValue(child.Output); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func (m *MultiOutput) logChildren() []interface{} {
+	children := make([]interface{}, 0, len(m.children))
+	for _, child := range m.children {
+		children = append(children, child.Output)
+	}
+	return children
+}
+
+// Children returns the MultiOutput's child TextOutputs.
+func (m *MultiOutput) Children() []LeveledOutput {
+	return append([]LeveledOutput(nil), m.children...)
+}
@@ -0,0 +1,124 @@
+// Copyright (C) 2017 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spacelog
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ConfigChangeKind says whether a ConfigChange is to a logger's level or to
+// its handler.
+type ConfigChangeKind int
+
+const (
+	LevelChange ConfigChangeKind = iota
+	HandlerChange
+)
+
+// ConfigChange describes a change to a logger's level or handler. Logger is
+// "DEFAULT" for changes to the collection's default level or handler. Source
+// says what made the change, such as "ConfigureLoggers", "SetLevel",
+// "SetHandler", "OverrideLevel", or "http <remote address>".
+type ConfigChange struct {
+	Kind       ConfigChangeKind
+	Logger     string
+	OldLevel   LogLevel
+	NewLevel   LogLevel
+	OldHandler Handler
+	NewHandler Handler
+	Source     string
+}
+
+type configSubscriber struct {
+	fn func(ConfigChange)
+}
+
+// Subscribe registers fn to be called for every change to a logger's level
+// or handler made through ConfigureLoggers, SetLevel, SetHandler,
+// OverrideLevel, or the HTTP level handler. This includes changes to loggers
+// that inherit their level. fn is called after the change has been made,
+// without any collection locks held, so it may log or make further changes,
+// but it may be called concurrently. The returned function unsubscribes fn.
+func (c *LoggerCollection) Subscribe(fn func(ConfigChange)) (
+	unsubscribe func()) {
+	sub := &configSubscriber{fn: fn}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	// subscribers is copied on write, so notifications can use a snapshot
+	subscribers := make([]*configSubscriber, 0, len(c.subscribers)+1)
+	c.subscribers = append(append(subscribers, c.subscribers...), sub)
+	return func() {
+		c.mtx.Lock()
+		defer c.mtx.Unlock()
+		for i, other := range c.subscribers {
+			if other == sub {
+				c.subscribers = append(c.subscribers[:i:i],
+					c.subscribers[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+func notifySubscribers(subscribers []*configSubscriber,
+	changes []ConfigChange) {
+	if len(subscribers) == 0 || len(changes) == 0 {
+		return
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Logger < changes[j].Logger
+	})
+	for _, change := range changes {
+		for _, sub := range subscribers {
+			sub.fn(change)
+		}
+	}
+}
+
+// LogConfigChanges subscribes to the collection's configuration changes and
+// logs each of them to the collection's "spacelog.config" logger, giving an
+// audit trail of who changed what. The returned function unsubscribes.
+func (c *LoggerCollection) LogConfigChanges() (unsubscribe func()) {
+	logger := c.GetLoggerNamed("spacelog.config")
+	return c.Subscribe(func(change ConfigChange) {
+		switch change.Kind {
+		case LevelChange:
+			logger.Noticew("logger level changed",
+				"logger", change.Logger,
+				"old", change.OldLevel.specString(),
+				"new", change.NewLevel.specString(),
+				"source", change.Source)
+		case HandlerChange:
+			logger.Noticew("logger handler changed",
+				"logger", change.Logger,
+				"old", fmt.Sprintf("%T", change.OldHandler),
+				"new", fmt.Sprintf("%T", change.NewHandler),
+				"source", change.Source)
+		}
+	})
+}
+
+// Subscribe registers fn to be called for every configuration change on the
+// default logger collection. See LoggerCollection.Subscribe.
+func Subscribe(fn func(ConfigChange)) (unsubscribe func()) {
+	return DefaultLoggerCollection.Subscribe(fn)
+}
+
+// LogConfigChanges logs every configuration change on the default logger
+// collection to its "spacelog.config" logger.
+func LogConfigChanges() (unsubscribe func()) {
+	return DefaultLoggerCollection.LogConfigChanges()
+}
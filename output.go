@@ -16,29 +16,99 @@ package spacelog
 
 import (
 	"bytes"
+	"compress/gzip"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type TextOutput interface {
 	Output(LogLevel, []byte)
 }
 
+// BatchMessage is a message in a batch passed to BatchOutput.OutputBatch.
+type BatchMessage struct {
+	Level   LogLevel
+	Message []byte
+}
+
+// BatchOutput is an optional interface for TextOutputs that can write several
+// messages at once more cheaply than one at a time, such as with a single
+// write to a file. BufferedOutput uses it when batching is configured.
+// OutputBatch must not keep the batch slice after it returns.
+type BatchOutput interface {
+	TextOutput
+	OutputBatch(batch []BatchMessage)
+}
+
 // WriterOutput is an io.Writer wrapper that matches the TextOutput interface
 type WriterOutput struct {
-	w io.Writer
+	w      io.Writer
+	health *outputHealth
 }
 
 // NewWriterOutput returns a TextOutput that writes messages to an io.Writer
 func NewWriterOutput(w io.Writer) *WriterOutput {
-	return &WriterOutput{w: w}
+	return &WriterOutput{w: w, health: new(outputHealth)}
 }
 
 func (o *WriterOutput) Output(_ LogLevel, message []byte) {
-	o.w.Write(append(bytes.TrimRight(message, "\r\n"), platformNewline...))
+	o.write(append(bytes.TrimRight(message, "\r\n"), platformNewline...), 1)
+}
+
+// write writes buf, which holds the given number of events, and records the
+// result
+func (o *WriterOutput) write(buf []byte, events int) {
+	n, err := o.w.Write(buf)
+	if err != nil {
+		o.health.failed(err)
+		o.health.dropped(events)
+		return
+	}
+	o.health.wrote(n, events)
+}
+
+// Stats returns what has been written and how writing has failed
+func (o *WriterOutput) Stats() OutputStats {
+	return o.health.Stats()
+}
+
+// SetErrorHandler registers fn to be called with each write error
+func (o *WriterOutput) SetErrorHandler(fn func(error)) {
+	o.health.SetErrorHandler(fn)
+}
+
+// OutputBatch writes the messages with a single Write call
+func (o *WriterOutput) OutputBatch(batch []BatchMessage) {
+	size := 0
+	for _, msg := range batch {
+		size += len(msg.Message) + len(platformNewline)
+	}
+	buf := make([]byte, 0, size)
+	for _, msg := range batch {
+		buf = append(append(buf, bytes.TrimRight(msg.Message, "\r\n")...),
+			platformNewline...)
+	}
+	o.write(buf, len(batch))
+}
+
+// Flush flushes the io.Writer if it has a Flush method, as bufio.Writer does
+func (o *WriterOutput) Flush() error {
+	if f, ok := o.w.(interface {
+		Flush() error
+	}); ok {
+		return f.Flush()
+	}
+	return nil
 }
 
 // StdlibOutput is a TextOutput that simply writes to the default Go stdlib
@@ -54,52 +124,300 @@ func (*StdlibOutput) Output(_ LogLevel, message []byte) {
 type bufferMsg struct {
 	level   LogLevel
 	message []byte
+
+	// if flushed is set, this is a request to flush the wrapped output once
+	// the messages before it are written
+	flushed chan error
+}
+
+// OverflowPolicy says what a BufferedOutput does with a message when its
+// buffer is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock waits until there is room in the buffer.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropNewest drops the new message.
+	OverflowDropNewest
+	// OverflowDropOldest drops the oldest buffered message to make room for
+	// the new one.
+	OverflowDropOldest
+	// OverflowDropBelow drops the new message if its level is below the
+	// BufferOptions' DropLevel, and otherwise waits.
+	OverflowDropBelow
+)
+
+// BufferOptions configures a BufferedOutput.
+type BufferOptions struct {
+	// Overflow is what to do with a message when the buffer is full.
+	Overflow OverflowPolicy
+
+	// DropLevel is the level below which messages are dropped, with
+	// OverflowDropBelow.
+	DropLevel LogLevel
+
+	// ReportInterval is how often to write a "N messages dropped" line to the
+	// wrapped output, if any messages were dropped since the last one. Zero
+	// reports them only when the BufferedOutput is closed.
+	ReportInterval time.Duration
+
+	// MaxBatchBytes, if positive, makes the BufferedOutput write buffered
+	// messages to the wrapped output in batches of up to about this many
+	// bytes, with OutputBatch if the wrapped output is a BatchOutput. Zero
+	// writes each message on its own.
+	MaxBatchBytes int
+
+	// MaxBatchLatency is how long the first message in a batch may wait for
+	// more messages before the batch is written. Zero writes a batch as soon
+	// as the buffer is empty, so messages are only batched while the wrapped
+	// output is falling behind.
+	MaxBatchLatency time.Duration
 }
 
 // BufferedOutput uses a channel to synchronize writes to a wrapped TextOutput
-// and allows for buffering a limited amount of log events.
+// and allows for buffering a limited amount of log events. What happens when
+// the buffer is full depends on its OverflowPolicy. Messages written after
+// Close are dropped.
 type BufferedOutput struct {
-	o          TextOutput
-	c          chan bufferMsg
-	running    sync.Mutex
-	close_once sync.Once
+	// accessed atomically, so first for alignment
+	dropped    uint64
+	unreported uint64
+	written    uint64
+
+	o    TextOutput
+	c    chan bufferMsg
+	opts BufferOptions
+	// running is held by process until it has drained the buffer, and after
+	// that by each flush made directly to o once the BufferedOutput is closed
+	running sync.Mutex
+
+	mtx    sync.RWMutex
+	closed bool
 }
 
 // NewBufferedOutput returns a BufferedOutput wrapping output with a buffer
-// size of buffer.
+// size of buffer. Output blocks while the buffer is full.
 func NewBufferedOutput(output TextOutput, buffer int) *BufferedOutput {
+	return NewBufferedOutputWithOptions(output, buffer, BufferOptions{})
+}
+
+// NewBufferedOutputWithOptions returns a BufferedOutput wrapping output with a
+// buffer size of buffer, configured by opts.
+func NewBufferedOutputWithOptions(output TextOutput, buffer int,
+	opts BufferOptions) *BufferedOutput {
 	if buffer < 0 {
 		buffer = 0
 	}
 	b := &BufferedOutput{
-		o: output,
-		c: make(chan bufferMsg, buffer)}
+		o:    output,
+		c:    make(chan bufferMsg, buffer),
+		opts: opts}
+	// locked here rather than in process so Close can't miss it
+	b.running.Lock()
 	go b.process()
 	return b
 }
 
-// Close shuts down the BufferedOutput's processing
+// Close shuts down the BufferedOutput's processing, once the messages already
+// buffered are written, and then closes the wrapped output if it can be
+// closed.
 func (b *BufferedOutput) Close() {
-	b.close_once.Do(func() {
+	b.mtx.Lock()
+	closing := !b.closed
+	if closing {
+		b.closed = true
 		close(b.c)
-	})
+	}
+	b.mtx.Unlock()
 	b.running.Lock()
 	b.running.Unlock()
+	if closing {
+		closeValue(b.o)
+	}
+}
+
+// Flush waits until the messages already buffered are written, and then
+// flushes the wrapped output.
+func (b *BufferedOutput) Flush() error {
+	b.mtx.RLock()
+	if b.closed {
+		b.mtx.RUnlock()
+		b.running.Lock()
+		defer b.running.Unlock()
+		return flushValue(b.o)
+	}
+	flushed := make(chan error, 1)
+	b.c <- bufferMsg{flushed: flushed}
+	b.mtx.RUnlock()
+	return <-flushed
+}
+
+// Dropped returns the number of messages dropped because the buffer was full
+// or the BufferedOutput was closed.
+func (b *BufferedOutput) Dropped() uint64 {
+	return atomic.LoadUint64(&b.dropped)
+}
+
+// Stats reports the number of messages passed on to the wrapped output as
+// Events, and the number dropped because the buffer was full or the
+// BufferedOutput was closed. What the wrapped output writes is in its own
+// Stats.
+func (b *BufferedOutput) Stats() OutputStats {
+	return OutputStats{
+		Events:  atomic.LoadUint64(&b.written),
+		Dropped: atomic.LoadUint64(&b.dropped)}
+}
+
+// SetErrorHandler is a no-op, as BufferedOutput has no errors of its own
+func (b *BufferedOutput) SetErrorHandler(fn func(error)) {}
+
+func (b *BufferedOutput) logChildren() []interface{} {
+	return []interface{}{b.o}
 }
 
 func (b *BufferedOutput) Output(level LogLevel, message []byte) {
-	b.c <- bufferMsg{level: level, message: message}
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+	if b.closed {
+		// the wrapped output may be closed already
+		atomic.AddUint64(&b.dropped, 1)
+		return
+	}
+	msg := bufferMsg{level: level, message: message}
+	switch b.opts.Overflow {
+	case OverflowDropNewest:
+		b.offer(msg)
+	case OverflowDropOldest:
+		if cap(b.c) == 0 {
+			b.offer(msg)
+			return
+		}
+		for {
+			select {
+			case b.c <- msg:
+				return
+			default:
+			}
+			select {
+			case old := <-b.c:
+				if old.flushed != nil {
+					// flush requests aren't dropped, just requeued
+					b.c <- old
+				} else {
+					b.drop()
+				}
+			default:
+			}
+		}
+	case OverflowDropBelow:
+		if level < b.opts.DropLevel {
+			b.offer(msg)
+			return
+		}
+		b.c <- msg
+	default:
+		b.c <- msg
+	}
+}
+
+// offer buffers msg if there is room, and drops it if not.
+func (b *BufferedOutput) offer(msg bufferMsg) {
+	select {
+	case b.c <- msg:
+	default:
+		b.drop()
+	}
+}
+
+func (b *BufferedOutput) drop() {
+	atomic.AddUint64(&b.dropped, 1)
+	atomic.AddUint64(&b.unreported, 1)
+}
+
+// reportDropped writes a line to the wrapped output saying how many messages
+// were dropped since the last report, if any were.
+func (b *BufferedOutput) reportDropped() {
+	n := atomic.SwapUint64(&b.unreported, 0)
+	if n > 0 {
+		b.o.Output(Warning, []byte(fmt.Sprintf(
+			"spacelog: %d messages dropped because the log buffer was full", n)))
+	}
 }
 
 func (b *BufferedOutput) process() {
-	b.running.Lock()
 	defer b.running.Unlock()
+	var report <-chan time.Time
+	if b.opts.ReportInterval > 0 {
+		ticker := time.NewTicker(b.opts.ReportInterval)
+		defer ticker.Stop()
+		report = ticker.C
+	}
+
+	var batch []BatchMessage
+	batch_bytes := 0
+	var timer *time.Timer
+	var deadline <-chan time.Time
+	write := func() {
+		if timer != nil {
+			timer.Stop()
+			timer, deadline = nil, nil
+		}
+		if len(batch) > 0 {
+			b.writeBatch(batch)
+			batch, batch_bytes = batch[:0], 0
+		}
+	}
+
 	for {
-		msg, open := <-b.c
-		if !open {
-			break
+		if len(batch) > 0 && b.opts.MaxBatchLatency <= 0 && len(b.c) == 0 {
+			write()
 		}
-		b.o.Output(msg.level, msg.message)
+		select {
+		case msg, open := <-b.c:
+			if !open {
+				write()
+				b.reportDropped()
+				return
+			}
+			if msg.flushed != nil {
+				write()
+				b.reportDropped()
+				msg.flushed <- flushValue(b.o)
+				continue
+			}
+			if b.opts.MaxBatchBytes <= 0 {
+				b.o.Output(msg.level, msg.message)
+				atomic.AddUint64(&b.written, 1)
+				continue
+			}
+			batch = append(batch, BatchMessage{
+				Level:   msg.level,
+				Message: msg.message})
+			batch_bytes += len(msg.message)
+			if batch_bytes >= b.opts.MaxBatchBytes {
+				write()
+			} else if timer == nil && b.opts.MaxBatchLatency > 0 {
+				timer = time.NewTimer(b.opts.MaxBatchLatency)
+				deadline = timer.C
+			}
+		case <-deadline:
+			write()
+		case <-report:
+			write()
+			b.reportDropped()
+		}
+	}
+}
+
+// writeBatch writes a batch of messages to the wrapped output.
+func (b *BufferedOutput) writeBatch(batch []BatchMessage) {
+	atomic.AddUint64(&b.written, uint64(len(batch)))
+	if bo, ok := b.o.(BatchOutput); ok {
+		bo.OutputBatch(batch)
+		return
+	}
+	for _, msg := range batch {
+		b.o.Output(msg.Level, msg.Message)
 	}
 }
 
@@ -116,6 +434,69 @@ type HupHandlingTextOutput interface {
 type FileWriterOutput struct {
 	*WriterOutput
 	path string
+	mtx  sync.Mutex
+
+	sync_policy SyncPolicy
+	unsynced    int
+	sync_timer  *time.Timer
+
+	health outputHealth
+}
+
+// SyncPolicy says when a FileWriterOutput or RotatingFileOutput syncs its file
+// to stable storage. The conditions may be combined; the zero value never
+// syncs, except on Flush and Close.
+type SyncPolicy struct {
+	// Every, if positive, syncs the file after every Every messages. Every
+	// set to 1 syncs after each message.
+	Every int
+
+	// Interval, if positive, syncs the file no later than Interval after a
+	// message is written.
+	Interval time.Duration
+
+	// Level, if not zero, syncs the file after each message at or above
+	// Level, before Output returns.
+	Level LogLevel
+}
+
+// SetSyncPolicy changes when the file is synced to stable storage.
+func (fo *FileWriterOutput) SetSyncPolicy(policy SyncPolicy) {
+	fo.mtx.Lock()
+	defer fo.mtx.Unlock()
+	fo.sync_policy = policy
+	if fo.sync_timer != nil && policy.Interval <= 0 {
+		fo.sync_timer.Stop()
+		fo.sync_timer = nil
+	}
+}
+
+// written applies the sync policy after count messages, the highest at
+// level, are written. fo.mtx must be held.
+func (fo *FileWriterOutput) written(level LogLevel, count int) {
+	policy := fo.sync_policy
+	fo.unsynced += count
+	if (policy.Level != 0 && level >= policy.Level) ||
+		(policy.Every > 0 && fo.unsynced >= policy.Every) {
+		if err := fo.sync(); err != nil {
+			fo.fallbackLog("Syncing %#v failed: %s", fo.path, err)
+		}
+		return
+	}
+	if policy.Interval > 0 && fo.sync_timer == nil {
+		fo.sync_timer = time.AfterFunc(policy.Interval, fo.syncInterval)
+	}
+}
+
+func (fo *FileWriterOutput) syncInterval() {
+	fo.mtx.Lock()
+	defer fo.mtx.Unlock()
+	fo.sync_timer = nil
+	if fo.unsynced > 0 {
+		if err := fo.sync(); err != nil {
+			fo.fallbackLog("Syncing %#v failed: %s", fo.path, err)
+		}
+	}
 }
 
 // Creates a new FileWriterOutput object. This is the only case where an
@@ -128,7 +509,7 @@ func NewFileWriterOutput(path string) (*FileWriterOutput, error) {
 	if err != nil {
 		return nil, err
 	}
-	fo.WriterOutput = NewWriterOutput(fh)
+	fo.WriterOutput = &WriterOutput{w: fh, health: &fo.health}
 	return fo, nil
 }
 
@@ -137,27 +518,81 @@ func (fo *FileWriterOutput) openFile() (*os.File, error) {
 	return os.OpenFile(fo.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
 }
 
-// Try to communicate a message without using our log file. In all likelihood,
-// stderr is closed or redirected to /dev/null, but at least we can try
-// writing there. In the very worst case, if an admin attaches a ptrace to
-// this process, it will be more clear what the problem is.
+// Try to communicate a message without using our log file. The error goes to
+// the error handler, if there is one. Otherwise, in all likelihood, stderr is
+// closed or redirected to /dev/null, but at least we can try writing there.
+// In the very worst case, if an admin attaches a ptrace to this process, it
+// will be more clear what the problem is.
 func (fo *FileWriterOutput) fallbackLog(tmpl string, args ...interface{}) {
-	fmt.Fprintf(os.Stderr, tmpl, args...)
+	if !fo.health.failed(fmt.Errorf(tmpl, args...)) {
+		fmt.Fprintf(os.Stderr, tmpl, args...)
+	}
+}
+
+// Stats returns what has been written to the file and how writing, opening,
+// syncing and rotating it have failed
+func (fo *FileWriterOutput) Stats() OutputStats {
+	return fo.health.Stats()
+}
+
+// SetErrorHandler registers fn to be called with each error, instead of
+// reporting it on stderr
+func (fo *FileWriterOutput) SetErrorHandler(fn func(error)) {
+	fo.health.SetErrorHandler(fn)
 }
 
 // Output a log line by writing it to the file. If the file has been
 // released, try to open it again. If that fails, cry for a little
 // while, then throw away the message and carry on.
 func (fo *FileWriterOutput) Output(ll LogLevel, message []byte) {
+	fo.mtx.Lock()
+	defer fo.mtx.Unlock()
+	fo.output(ll, message)
+}
+
+// OutputBatch writes several log lines to the file with a single write,
+// opening the file again first if needed.
+func (fo *FileWriterOutput) OutputBatch(batch []BatchMessage) {
+	fo.mtx.Lock()
+	defer fo.mtx.Unlock()
+	if len(batch) == 0 {
+		return
+	}
+	if !fo.open() {
+		fo.health.dropped(len(batch))
+		return
+	}
+	fo.WriterOutput.OutputBatch(batch)
+	level := batch[0].Level
+	for _, msg := range batch[1:] {
+		if msg.Level > level {
+			level = msg.Level
+		}
+	}
+	fo.written(level, len(batch))
+}
+
+// open opens the file again if it has been released, reporting whether it is
+// open.
+func (fo *FileWriterOutput) open() bool {
 	if fo.WriterOutput == nil {
 		fh, err := fo.openFile()
 		if err != nil {
 			fo.fallbackLog("Could not open %#v: %s", fo.path, err)
-			return
+			return false
 		}
-		fo.WriterOutput = NewWriterOutput(fh)
+		fo.WriterOutput = &WriterOutput{w: fh, health: &fo.health}
+	}
+	return true
+}
+
+func (fo *FileWriterOutput) output(ll LogLevel, message []byte) {
+	if !fo.open() {
+		fo.health.dropped(1)
+		return
 	}
 	fo.WriterOutput.Output(ll, message)
+	fo.written(ll, 1)
 }
 
 // Throw away any references/handles to the output file. This probably
@@ -165,6 +600,17 @@ func (fo *FileWriterOutput) Output(ll LogLevel, message []byte) {
 // open a new one. Close the underlying io.Writer if that is a thing
 // that it knows how to do.
 func (fo *FileWriterOutput) OnHup() {
+	fo.mtx.Lock()
+	defer fo.mtx.Unlock()
+	fo.release()
+}
+
+func (fo *FileWriterOutput) release() {
+	if fo.unsynced > 0 && fo.sync_policy != (SyncPolicy{}) {
+		if err := fo.sync(); err != nil {
+			fo.fallbackLog("Syncing %#v failed: %s", fo.path, err)
+		}
+	}
 	if fo.WriterOutput != nil {
 		wc, ok := fo.WriterOutput.w.(io.Closer)
 		if ok {
@@ -176,3 +622,480 @@ func (fo *FileWriterOutput) OnHup() {
 		fo.WriterOutput = nil
 	}
 }
+
+// Flush syncs the file to stable storage.
+func (fo *FileWriterOutput) Flush() error {
+	fo.mtx.Lock()
+	defer fo.mtx.Unlock()
+	return fo.sync()
+}
+
+func (fo *FileWriterOutput) sync() error {
+	fo.unsynced = 0
+	if fo.sync_timer != nil {
+		fo.sync_timer.Stop()
+		fo.sync_timer = nil
+	}
+	if fo.WriterOutput == nil {
+		return nil
+	}
+	if fh, ok := fo.WriterOutput.w.(*os.File); ok {
+		return fh.Sync()
+	}
+	return fo.WriterOutput.Flush()
+}
+
+// Close syncs and closes the file. As after OnHup, a later write opens the
+// file again.
+func (fo *FileWriterOutput) Close() error {
+	fo.mtx.Lock()
+	defer fo.mtx.Unlock()
+	err := fo.sync()
+	fo.release()
+	return err
+}
+
+// RotateOptions configures when a RotatingFileOutput rolls its file over and
+// which old files it keeps.
+type RotateOptions struct {
+	// MaxSize is the size in bytes past which the file is rotated. Zero
+	// disables size-based rotation.
+	MaxSize int64
+
+	// Interval is how often the file is rotated, aligned to the interval
+	// boundary (e.g. time.Hour rotates on the hour, and 24*time.Hour rotates
+	// at local midnight). Zero disables time-based rotation.
+	Interval time.Duration
+
+	// MaxBackups is the number of rotated files to keep. Zero keeps all of
+	// them.
+	MaxBackups int
+
+	// MaxTotalSize is the combined size in bytes of all the rotated files to
+	// keep, unlike MaxSize, which limits the current file. The oldest files
+	// are removed first. Zero disables the limit.
+	MaxTotalSize int64
+
+	// MaxAge is how long to keep rotated files, based on their modification
+	// time. Zero keeps them forever.
+	MaxAge time.Duration
+
+	// Compress gzips rotated files, adding a .gz suffix.
+	Compress bool
+
+	// IndexNames names rotated files <path>.1, <path>.2 and so on, with
+	// <path>.1 being the most recent, instead of suffixing them with the
+	// time of rotation.
+	IndexNames bool
+}
+
+// RotatingFileOutput is a FileWriterOutput that also rotates its file once it
+// grows past a maximum size or a time boundary passes. Rotating only moves
+// the file aside; renaming, compressing and pruning rotated files happens in
+// the background so that it never blocks Output. Failures there are reported
+// like other FileWriterOutput failures, and never remove a file that hasn't
+// been compressed successfully. RotatingFileOutput still reopens its file on
+// OnHup, so external rotation continues to work.
+type RotatingFileOutput struct {
+	*FileWriterOutput
+	opts RotateOptions
+
+	mtx  sync.Mutex
+	size int64
+	next time.Time
+
+	maintain_mtx     sync.Mutex
+	maintaining      bool
+	maintain_pending bool
+	maintain_wg      sync.WaitGroup
+}
+
+// NewRotatingFileOutput creates a new RotatingFileOutput writing to path and
+// rotating it according to opts. As with NewFileWriterOutput, this is the
+// only case where an error opening the file will be reported to the caller.
+func NewRotatingFileOutput(path string, opts RotateOptions) (
+	*RotatingFileOutput, error) {
+	fo, err := NewFileWriterOutput(path)
+	if err != nil {
+		return nil, err
+	}
+	ro := &RotatingFileOutput{
+		FileWriterOutput: fo,
+		opts:             opts}
+	ro.statFile()
+	ro.next = nextRotation(time.Now(), opts.Interval)
+	return ro, nil
+}
+
+// Output writes a log line to the file, first rotating the file if the line
+// would take it past the maximum size or if a rotation boundary has passed.
+func (ro *RotatingFileOutput) Output(ll LogLevel, message []byte) {
+	ro.mtx.Lock()
+	defer ro.mtx.Unlock()
+	n := int64(len(message) + len(platformNewline))
+	if !ro.prepare(time.Now(), n) {
+		ro.health.dropped(1)
+		return
+	}
+	ro.FileWriterOutput.Output(ll, message)
+	ro.size += n
+}
+
+// OutputBatch writes several log lines to the file, with a single write for
+// each run of lines that doesn't cross a rotation.
+func (ro *RotatingFileOutput) OutputBatch(batch []BatchMessage) {
+	ro.mtx.Lock()
+	defer ro.mtx.Unlock()
+	now := time.Now()
+	var pending []BatchMessage
+	for _, msg := range batch {
+		n := int64(len(msg.Message) + len(platformNewline))
+		if ro.rotationDue(now, n) && len(pending) > 0 {
+			ro.FileWriterOutput.OutputBatch(pending)
+			pending = pending[:0]
+		}
+		if !ro.prepare(now, n) {
+			ro.health.dropped(1)
+			continue
+		}
+		pending = append(pending, msg)
+		ro.size += n
+	}
+	if len(pending) > 0 {
+		ro.FileWriterOutput.OutputBatch(pending)
+	}
+}
+
+// rotationDue reports whether writing n more bytes at time now needs the file
+// to be rotated first.
+func (ro *RotatingFileOutput) rotationDue(now time.Time, n int64) bool {
+	return (ro.opts.MaxSize > 0 && ro.size > 0 && ro.size+n > ro.opts.MaxSize) ||
+		(ro.opts.Interval > 0 && !now.Before(ro.next))
+}
+
+// prepare rotates the file if writing n more bytes at time now needs it,
+// and opens the file if it isn't open, reporting whether it is open.
+func (ro *RotatingFileOutput) prepare(now time.Time, n int64) bool {
+	if ro.rotationDue(now, n) {
+		ro.rotate(now)
+	}
+	fo := ro.FileWriterOutput
+	fo.mtx.Lock()
+	reopened := fo.WriterOutput == nil
+	open := fo.open()
+	fo.mtx.Unlock()
+	if open && reopened {
+		ro.statFile()
+	}
+	return open
+}
+
+// Rotate rotates the file immediately.
+func (ro *RotatingFileOutput) Rotate() {
+	ro.mtx.Lock()
+	defer ro.mtx.Unlock()
+	ro.rotate(time.Now())
+}
+
+// OnHup closes the file so that it is reopened on the next write.
+func (ro *RotatingFileOutput) OnHup() {
+	ro.mtx.Lock()
+	defer ro.mtx.Unlock()
+	ro.FileWriterOutput.OnHup()
+	ro.size = 0
+}
+
+// Flush syncs the file to stable storage.
+func (ro *RotatingFileOutput) Flush() error {
+	ro.mtx.Lock()
+	defer ro.mtx.Unlock()
+	return ro.FileWriterOutput.Flush()
+}
+
+// Close syncs and closes the file, and waits for any background work on
+// rotated files to finish. A later write opens the file again.
+func (ro *RotatingFileOutput) Close() error {
+	ro.mtx.Lock()
+	defer ro.mtx.Unlock()
+	err := ro.FileWriterOutput.Close()
+	ro.size = 0
+	ro.maintain_wg.Wait()
+	return err
+}
+
+func (ro *RotatingFileOutput) statFile() {
+	ro.size = 0
+	if fi, err := os.Stat(ro.path); err == nil {
+		ro.size = fi.Size()
+	}
+}
+
+// rotate closes the current file and moves it aside under a timestamped
+// name, then kicks off background maintenance of the rotated files. The new
+// file is opened on the next write.
+func (ro *RotatingFileOutput) rotate(now time.Time) {
+	ro.FileWriterOutput.OnHup()
+	ro.size = 0
+	ro.next = nextRotation(now, ro.opts.Interval)
+
+	if !fileExists(ro.path) {
+		return
+	}
+	stamp := now.Format(rotatedTimeFormat)
+	target := ro.path + "." + stamp
+	for i := 1; fileExists(target) || fileExists(target+".gz"); i++ {
+		target = fmt.Sprintf("%s.%s.%d", ro.path, stamp, i)
+	}
+	err := os.Rename(ro.path, target)
+	if err != nil {
+		ro.fallbackLog("Rotating %#v failed: %s", ro.path, err)
+		return
+	}
+	ro.maintain_mtx.Lock()
+	defer ro.maintain_mtx.Unlock()
+	ro.maintain_pending = true
+	if !ro.maintaining {
+		ro.maintaining = true
+		ro.maintain_wg.Add(1)
+		go ro.maintainBackups()
+	}
+}
+
+// maintainBackups runs in the background, renaming, compressing and pruning
+// rotated files until no rotation has happened since it last looked, and
+// then exits. At most one runs at a time, and it is the only thing that
+// touches rotated files, so none of that work races with itself.
+func (ro *RotatingFileOutput) maintainBackups() {
+	defer ro.maintain_wg.Done()
+	for {
+		ro.maintain_mtx.Lock()
+		if !ro.maintain_pending {
+			ro.maintaining = false
+			ro.maintain_mtx.Unlock()
+			return
+		}
+		ro.maintain_pending = false
+		ro.maintain_mtx.Unlock()
+
+		if ro.opts.IndexNames {
+			ro.indexBackups()
+		}
+		if ro.opts.Compress {
+			for _, backup := range ro.backups() {
+				if !strings.HasSuffix(backup.path, ".gz") {
+					ro.compress(backup.path)
+				}
+			}
+		}
+		ro.prune()
+	}
+}
+
+// indexBackups renames freshly rotated, timestamped files to <path>.1,
+// shifting older indexed files up by one.
+func (ro *RotatingFileOutput) indexBackups() {
+	stamped := ro.listBackups(false)
+	for i := len(stamped) - 1; i >= 0; i-- {
+		indexed := ro.listBackups(true)
+		for j := len(indexed) - 1; j >= 0; j-- {
+			ro.rename(indexed[j].path, ro.indexName(indexed[j].index+1)+
+				gzipSuffix(indexed[j].path))
+		}
+		ro.rename(stamped[i].path,
+			ro.indexName(1)+gzipSuffix(stamped[i].path))
+	}
+}
+
+func (ro *RotatingFileOutput) rename(from, to string) {
+	err := os.Rename(from, to)
+	if err != nil {
+		ro.fallbackLog("Renaming %#v failed: %s", from, err)
+	}
+}
+
+// compress gzips path to path.gz, and only removes path once the compressed
+// copy has been completely written. The compressed copy keeps the original's
+// modification time, so MaxAge still counts from the rotation.
+func (ro *RotatingFileOutput) compress(path string) {
+	err := gzipFile(path, path+".gz")
+	if err != nil {
+		ro.fallbackLog("Compressing %#v failed: %s", path, err)
+		return
+	}
+	err = os.Remove(path)
+	if err != nil {
+		ro.fallbackLog("Removing %#v failed: %s", path, err)
+	}
+}
+
+func gzipFile(src, dst string) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp := dst + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			out.Close()
+			os.Remove(tmp)
+		}
+	}()
+	gz := gzip.NewWriter(out)
+	_, err = io.Copy(gz, in)
+	if err != nil {
+		return err
+	}
+	err = gz.Close()
+	if err != nil {
+		return err
+	}
+	err = out.Sync()
+	if err != nil {
+		return err
+	}
+	err = out.Close()
+	if err != nil {
+		return err
+	}
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	err = os.Chtimes(tmp, fi.ModTime(), fi.ModTime())
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
+
+// prune removes the oldest rotated files beyond the configured maximum count,
+// total size, or age.
+func (ro *RotatingFileOutput) prune() {
+	var total int64
+	now := time.Now()
+	for i, backup := range ro.backups() {
+		total += backup.size
+		if (ro.opts.MaxBackups > 0 && i >= ro.opts.MaxBackups) ||
+			(ro.opts.MaxTotalSize > 0 && total > ro.opts.MaxTotalSize) ||
+			(ro.opts.MaxAge > 0 && now.Sub(backup.mod) > ro.opts.MaxAge) {
+			err := os.Remove(backup.path)
+			if err != nil {
+				ro.fallbackLog("Removing %#v failed: %s", backup.path, err)
+			}
+		}
+	}
+}
+
+func (ro *RotatingFileOutput) indexName(i int) string {
+	return fmt.Sprintf("%s.%d", ro.path, i)
+}
+
+// rotatedFile is a rotated file named either <path>.<index> or
+// <path>.<stamp>, with .<index> added if several rotations share a stamp.
+type rotatedFile struct {
+	path  string
+	stamp string
+	index int
+	size  int64
+	mod   time.Time
+}
+
+// backups returns the rotated files, newest first.
+func (ro *RotatingFileOutput) backups() []rotatedFile {
+	return ro.listBackups(ro.opts.IndexNames)
+}
+
+// listBackups returns either the indexed or the timestamped rotated files,
+// newest first.
+func (ro *RotatingFileOutput) listBackups(indexed bool) []rotatedFile {
+	dir, base := filepath.Split(ro.path)
+	if dir == "" {
+		dir = "."
+	}
+	fh, err := os.Open(dir)
+	if err != nil {
+		return nil
+	}
+	names, err := fh.Readdirnames(-1)
+	fh.Close()
+	if err != nil {
+		return nil
+	}
+	var backups []rotatedFile
+	for _, name := range names {
+		suffix := strings.TrimPrefix(name, base+".")
+		if suffix == name {
+			continue
+		}
+		suffix = strings.TrimSuffix(suffix, ".gz")
+		backup := rotatedFile{path: filepath.Join(dir, name)}
+		switch {
+		case indexed:
+			backup.index, err = strconv.Atoi(suffix)
+			if err != nil || backup.index <= 0 {
+				continue
+			}
+		case rotatedTimestamp.MatchString(suffix):
+			// the index tells apart rotations within the same second
+			backup.stamp = suffix[:len(rotatedTimeFormat)]
+			if len(suffix) > len(backup.stamp) {
+				backup.index, _ = strconv.Atoi(suffix[len(backup.stamp)+1:])
+			}
+		default:
+			continue
+		}
+		fi, err := os.Stat(backup.path)
+		if err != nil {
+			continue
+		}
+		backup.size, backup.mod = fi.Size(), fi.ModTime()
+		backups = append(backups, backup)
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		if indexed {
+			return backups[i].index < backups[j].index
+		}
+		if backups[i].stamp != backups[j].stamp {
+			return backups[i].stamp > backups[j].stamp
+		}
+		return backups[i].index > backups[j].index
+	})
+	return backups
+}
+
+const rotatedTimeFormat = "2006-01-02T15-04-05"
+
+var rotatedTimestamp = regexp.MustCompile(
+	`^\d{4}-\d{2}-\d{2}T\d{2}-\d{2}-\d{2}(\.\d+)?$`)
+
+func gzipSuffix(path string) string {
+	if strings.HasSuffix(path, ".gz") {
+		return ".gz"
+	}
+	return ""
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// nextRotation returns the first interval boundary after now. Intervals that
+// are a whole number of days are aligned to local midnight.
+func nextRotation(now time.Time, interval time.Duration) time.Time {
+	if interval <= 0 {
+		return time.Time{}
+	}
+	const day = 24 * time.Hour
+	if interval%day == 0 {
+		y, m, d := now.Date()
+		midnight := time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+		return midnight.AddDate(0, 0, int(interval/day))
+	}
+	return now.Truncate(interval).Add(interval)
+}
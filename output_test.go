@@ -0,0 +1,421 @@
+// Copyright (C) 2017 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spacelog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testOutput records what is written to it. If gate is set, each write
+// first announces itself on entered and then waits for gate.
+type testOutput struct {
+	mtx     sync.Mutex
+	msgs    []string
+	batches [][]string
+	times   []time.Time
+	closed  bool
+	t       *testing.T
+	entered chan struct{}
+	gate    chan struct{}
+}
+
+func (o *testOutput) Output(_ LogLevel, message []byte) {
+	o.wait()
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	o.check()
+	o.msgs = append(o.msgs, string(message))
+	o.times = append(o.times, time.Now())
+}
+
+func (o *testOutput) wait() {
+	if o.gate != nil {
+		o.entered <- struct{}{}
+		<-o.gate
+	}
+}
+
+func (o *testOutput) check() {
+	if o.closed {
+		o.t.Errorf("write after close")
+	}
+}
+
+func (o *testOutput) Close() error {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	o.closed = true
+	return nil
+}
+
+func (o *testOutput) messages() []string {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	return append([]string(nil), o.msgs...)
+}
+
+// testBatchOutput is a testOutput that records batches too.
+type testBatchOutput struct {
+	testOutput
+}
+
+func (o *testBatchOutput) OutputBatch(batch []BatchMessage) {
+	o.wait()
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	o.check()
+	var msgs []string
+	for _, msg := range batch {
+		msgs = append(msgs, string(msg.Message))
+	}
+	o.msgs = append(o.msgs, msgs...)
+	o.batches = append(o.batches, msgs)
+	o.times = append(o.times, time.Now())
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestBufferedOutputDropOldestKeepsFlush(t *testing.T) {
+	out := &testOutput{t: t,
+		entered: make(chan struct{}),
+		gate:    make(chan struct{})}
+	b := NewBufferedOutputWithOptions(out, 2,
+		BufferOptions{Overflow: OverflowDropOldest})
+	defer b.Close()
+
+	// hold process in the wrapped output, so the buffer fills up
+	b.Output(Info, []byte("a"))
+	<-out.entered
+	flushed := make(chan error, 1)
+	go func() { flushed <- b.Flush() }()
+	waitFor(t, "the flush request", func() bool { return len(b.c) == 1 })
+
+	// the flush request is never the oldest message dropped
+	for _, msg := range []string{"b", "c", "d"} {
+		b.Output(Info, []byte(msg))
+	}
+	if dropped := b.Dropped(); dropped != 2 {
+		t.Errorf("got %d dropped, want 2", dropped)
+	}
+	close(out.gate)
+	go func() {
+		for range out.entered {
+		}
+	}()
+	select {
+	case err := <-flushed:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Flush didn't return")
+	}
+	b.Close()
+	close(out.entered)
+
+	msgs := out.messages()
+	want := []string{"a",
+		"spacelog: 2 messages dropped because the log buffer was full", "d"}
+	if len(msgs) != len(want) {
+		t.Fatalf("got %q, want %q", msgs, want)
+	}
+	for i := range want {
+		if msgs[i] != want[i] {
+			t.Fatalf("got %q, want %q", msgs, want)
+		}
+	}
+}
+
+func TestBufferedOutputAfterClose(t *testing.T) {
+	for _, overflow := range []OverflowPolicy{OverflowBlock,
+		OverflowDropNewest, OverflowDropOldest, OverflowDropBelow} {
+		out := &testOutput{t: t}
+		b := NewBufferedOutputWithOptions(out, 1,
+			BufferOptions{Overflow: overflow})
+		b.Output(Info, []byte("before"))
+		b.Close()
+		b.Output(Info, []byte("after"))
+		b.Output(Error, []byte("after"))
+		b.Close()
+		if err := b.Flush(); err != nil {
+			t.Errorf("policy %d: Flush after Close: %s", overflow, err)
+		}
+		stats := b.Stats()
+		if stats.Events != 1 || stats.Dropped != 2 {
+			t.Errorf("policy %d: got %d events and %d dropped, want 1 and 2",
+				overflow, stats.Events, stats.Dropped)
+		}
+		if msgs := out.messages(); len(msgs) != 1 || msgs[0] != "before" {
+			t.Errorf("policy %d: got %q, want [before]", overflow, msgs)
+		}
+	}
+}
+
+func TestBufferedOutputBatchLatency(t *testing.T) {
+	const latency = 50 * time.Millisecond
+	out := &testBatchOutput{testOutput{t: t}}
+	b := NewBufferedOutputWithOptions(out, 10, BufferOptions{
+		MaxBatchBytes:   1 << 20,
+		MaxBatchLatency: latency})
+	defer b.Close()
+
+	start := time.Now()
+	for _, msg := range []string{"a", "b", "c"} {
+		b.Output(Info, []byte(msg))
+	}
+	waitFor(t, "the batch", func() bool { return len(out.messages()) == 3 })
+	out.mtx.Lock()
+	batches, written := out.batches, out.times[0]
+	out.mtx.Unlock()
+	if len(batches) != 1 || len(batches[0]) != 3 {
+		t.Errorf("got batches %q, want one batch of 3", batches)
+	}
+	if waited := written.Sub(start); waited < latency {
+		t.Errorf("batch written after %s, before the latency of %s", waited,
+			latency)
+	} else if waited > latency+time.Second {
+		t.Errorf("batch written after %s, well past the latency of %s",
+			waited, latency)
+	}
+}
+
+func TestBufferedOutputBatchSize(t *testing.T) {
+	out := &testBatchOutput{testOutput{t: t,
+		entered: make(chan struct{}),
+		gate:    make(chan struct{})}}
+	b := NewBufferedOutputWithOptions(out, 10, BufferOptions{
+		MaxBatchBytes: 4})
+
+	// while the first batch is held up, the rest queue and are batched by
+	// size, with what's left over written once the buffer is empty
+	b.Output(Info, []byte("a"))
+	<-out.entered
+	for _, msg := range []string{"bb", "cc", "dd", "ee", "f"} {
+		b.Output(Info, []byte(msg))
+	}
+	close(out.gate)
+	go func() {
+		for range out.entered {
+		}
+	}()
+	b.Close()
+	close(out.entered)
+
+	want := [][]string{{"a"}, {"bb", "cc"}, {"dd", "ee"}, {"f"}}
+	if len(out.batches) != len(want) {
+		t.Fatalf("got batches %q, want %q", out.batches, want)
+	}
+	for i := range want {
+		if strings.Join(out.batches[i], ",") != strings.Join(want[i], ",") {
+			t.Fatalf("got batches %q, want %q", out.batches, want)
+		}
+	}
+	if stats := b.Stats(); stats.Events != 6 {
+		t.Errorf("got %d events, want 6", stats.Events)
+	}
+}
+
+// rotatedFiles writes count 9-byte messages to a RotatingFileOutput with
+// opts and a MaxSize that fits one message per file, and returns the
+// contents of the rotated files by name, relative to the log file's path.
+func rotatedFiles(t *testing.T, opts RotateOptions, count int) (
+	files map[string]string, newest []string) {
+	dir, err := ioutil.TempDir("", "spacelog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+	opts.MaxSize = 10
+	ro, err := NewRotatingFileOutput(path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= count; i++ {
+		ro.Output(Info, []byte(fmt.Sprintf("message %d", i)))
+	}
+	err = ro.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats := ro.Stats(); stats.Errors != 0 || stats.Dropped != 0 {
+		t.Fatalf("got %d errors and %d dropped", stats.Errors, stats.Dropped)
+	}
+
+	for _, backup := range ro.backups() {
+		newest = append(newest, strings.TrimPrefix(backup.path, path))
+	}
+	files = make(map[string]string)
+	names, err := filepath.Glob(path + "*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.HasSuffix(name, ".gz") {
+			gz, err := gzip.NewReader(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("%s: %s", name, err)
+			}
+			data, err = ioutil.ReadAll(gz)
+			if err != nil {
+				t.Fatalf("%s: %s", name, err)
+			}
+		}
+		files[strings.TrimPrefix(name, path)] = strings.TrimSpace(string(data))
+	}
+	return files, newest
+}
+
+func TestRotatingFileOutputNames(t *testing.T) {
+	files, newest := rotatedFiles(t, RotateOptions{}, 4)
+	if len(files) != 4 || files[""] != "message 4" {
+		t.Fatalf("got files %q, want the current file and 3 rotated", files)
+	}
+	if len(newest) != 3 {
+		t.Fatalf("got rotated files %q, want 3", newest)
+	}
+	for i, name := range newest {
+		if !rotatedTimestamp.MatchString(strings.TrimPrefix(name, ".")) {
+			t.Errorf("rotated file %q isn't named by its time", name)
+		}
+		if want := fmt.Sprintf("message %d", 3-i); files[name] != want {
+			t.Errorf("rotated file %q holds %q, want %q", name, files[name],
+				want)
+		}
+	}
+
+	files, _ = rotatedFiles(t, RotateOptions{IndexNames: true}, 4)
+	want := map[string]string{
+		"":   "message 4",
+		".1": "message 3",
+		".2": "message 2",
+		".3": "message 1"}
+	if fmt.Sprint(files) != fmt.Sprint(want) {
+		t.Errorf("got files %q, want %q", files, want)
+	}
+}
+
+func TestRotatingFileOutputMaintenance(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		opts  RotateOptions
+		files map[string]string
+	}{
+		{name: "compressed",
+			opts: RotateOptions{IndexNames: true, Compress: true},
+			files: map[string]string{
+				"":      "message 4",
+				".1.gz": "message 3",
+				".2.gz": "message 2",
+				".3.gz": "message 1"}},
+		{name: "max backups",
+			opts: RotateOptions{IndexNames: true, MaxBackups: 2},
+			files: map[string]string{
+				"":   "message 4",
+				".1": "message 3",
+				".2": "message 2"}},
+		{name: "max total size",
+			opts: RotateOptions{IndexNames: true, MaxTotalSize: 25},
+			files: map[string]string{
+				"":   "message 4",
+				".1": "message 3",
+				".2": "message 2"}},
+		{name: "compressed max backups",
+			opts: RotateOptions{IndexNames: true, Compress: true,
+				MaxBackups: 1},
+			files: map[string]string{
+				"":      "message 4",
+				".1.gz": "message 3"}},
+	} {
+		files, _ := rotatedFiles(t, test.opts, 4)
+		if fmt.Sprint(files) != fmt.Sprint(test.files) {
+			t.Errorf("%s: got files %q, want %q", test.name, files,
+				test.files)
+		}
+	}
+
+	// timestamped files are compressed and pruned the same way
+	files, newest := rotatedFiles(t,
+		RotateOptions{Compress: true, MaxBackups: 2}, 4)
+	if len(files) != 3 || len(newest) != 2 {
+		t.Fatalf("got files %q, want the current file and 2 rotated", files)
+	}
+	for i, name := range newest {
+		if !strings.HasSuffix(name, ".gz") {
+			t.Errorf("rotated file %q isn't compressed", name)
+		}
+		if want := fmt.Sprintf("message %d", 3-i); files[name] != want {
+			t.Errorf("rotated file %q holds %q, want %q", name, files[name],
+				want)
+		}
+	}
+}
+
+func TestRotatingFileOutputMaxAge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spacelog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+	ro, err := NewRotatingFileOutput(path, RotateOptions{
+		IndexNames: true,
+		Compress:   true,
+		MaxAge:     time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ro.Output(Info, []byte("old"))
+	ro.Rotate()
+	ro.Close()
+	old := time.Now().Add(-2 * time.Hour)
+	err = os.Chtimes(path+".1.gz", old, old)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the next rotation prunes the old file once it has been renamed, and
+	// keeps the fresh one, whose compressed copy has its recent mtime
+	ro.Output(Info, []byte("new"))
+	ro.Rotate()
+	ro.Close()
+	if !fileExists(path + ".1.gz") {
+		t.Errorf("the fresh rotated file was removed")
+	}
+	if fileExists(path + ".2.gz") {
+		t.Errorf("the old rotated file was kept")
+	}
+}
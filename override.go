@@ -0,0 +1,118 @@
+// Copyright (C) 2017 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spacelog
+
+import (
+	"strings"
+	"time"
+)
+
+// LevelOverride is a temporary change to the levels of a LoggerCollection,
+// made with OverrideLevel.
+type LevelOverride struct {
+	c       *LoggerCollection
+	pattern string
+	level   LogLevel
+	expires time.Time
+	timer   *time.Timer
+}
+
+// OverrideLevel temporarily makes the loggers named by pattern, and their
+// descendants, at least as verbose as level, until the duration d has passed
+// or the returned LevelOverride is canceled. pattern is a logger name or a
+// glob pattern, as in ConfigureLoggers. Loggers that are already more
+// verbose than level are unaffected.
+//
+// Overrides are kept separately from the configured levels, so when an
+// override ends, every logger goes back to the level its configuration gives
+// it at that time, including any configuration changes made while the
+// override was in place.
+func (c *LoggerCollection) OverrideLevel(pattern string, level LogLevel,
+	d time.Duration) *LevelOverride {
+	o := &LevelOverride{
+		c:       c,
+		pattern: pattern,
+		level:   level,
+		expires: time.Now().Add(d)}
+	c.changeLevels("OverrideLevel", func() {
+		c.overrides = append(c.overrides, o)
+		o.timer = time.AfterFunc(d, func() {
+			o.end("OverrideLevel expired")
+		})
+	})
+	return o
+}
+
+// Cancel ends the override early. It is safe to call more than once.
+func (o *LevelOverride) Cancel() {
+	o.end("LevelOverride.Cancel")
+}
+
+func (o *LevelOverride) end(source string) {
+	c := o.c
+	c.changeLevels(source, func() {
+		o.timer.Stop()
+		for i, override := range c.overrides {
+			if override == o {
+				c.overrides = append(c.overrides[:i:i], c.overrides[i+1:]...)
+				return
+			}
+		}
+	})
+}
+
+// Pattern returns the logger name or pattern the override applies to.
+func (o *LevelOverride) Pattern() string { return o.pattern }
+
+// Level returns the level the override raises loggers to.
+func (o *LevelOverride) Level() LogLevel { return o.level }
+
+// Expires returns when the override ends, unless it is canceled first.
+func (o *LevelOverride) Expires() time.Time { return o.expires }
+
+// Overrides returns the overrides currently in place.
+func (c *LoggerCollection) Overrides() []*LevelOverride {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return append([]*LevelOverride(nil), c.overrides...)
+}
+
+// overrideLevel returns the most verbose level any override gives the named
+// logger, either directly or through one of its ancestors. c.mtx must be
+// held.
+func (c *LoggerCollection) overrideLevel(name string) (
+	level LogLevel, exists bool) {
+	for _, o := range c.overrides {
+		for n := name; ; n = n[:strings.LastIndex(n, ".")] {
+			if matchLevelPattern(o.pattern, n) {
+				if !exists || o.level < level {
+					level, exists = o.level, true
+				}
+				break
+			}
+			if !strings.Contains(n, ".") {
+				break
+			}
+		}
+	}
+	return level, exists
+}
+
+// OverrideLevel temporarily raises the verbosity of loggers on the default
+// logger collection. See LoggerCollection.OverrideLevel.
+func OverrideLevel(pattern string, level LogLevel,
+	d time.Duration) *LevelOverride {
+	return DefaultLoggerCollection.OverrideLevel(pattern, level, d)
+}
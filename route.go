@@ -0,0 +1,156 @@
+// Copyright (C) 2017 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spacelog
+
+import (
+	"text/template"
+)
+
+// Route is a rule for RouteHandler. A log event matches a Route if its level
+// is at or above Level and its logger name matches Pattern.
+type Route struct {
+	// Pattern is a logger name, or a glob pattern as used by
+	// ConfigureLoggers, such as audit.*. An empty Pattern matches every
+	// logger.
+	Pattern string
+
+	// Level is the lowest level the Route matches. The zero value matches
+	// every level.
+	Level LogLevel
+
+	// Handler gets the log events that match the Route. To send events to
+	// several Handlers, use a MultiHandler.
+	Handler Handler
+}
+
+func (r *Route) matches(logger_name string, level LogLevel) bool {
+	return level >= r.Level &&
+		(r.Pattern == "" || matchLevelPattern(r.Pattern, logger_name))
+}
+
+// RouteHandler is a Handler that passes each log event to the Handler of the
+// first Route it matches, or to a default Handler if it matches none. For
+// example, to send errors to syslog and stderr, the audit loggers to their
+// own file, and everything else to the main file:
+//
+//	spacelog.SetHandler(nil, spacelog.NewRouteHandler(main,
+//		spacelog.Route{Level: spacelog.Error,
+//			Handler: spacelog.NewMultiHandler(
+//				spacelog.LeveledHandler{Handler: syslog},
+//				spacelog.LeveledHandler{Handler: stderr})},
+//		spacelog.Route{Pattern: "audit.*", Handler: audit}))
+//
+// Since the routing is done by the Handler, it applies to every logger the
+// RouteHandler is set on, including loggers created later.
+type RouteHandler struct {
+	routes []Route
+	def    Handler
+}
+
+// NewRouteHandler creates a Handler that routes log events to the first
+// matching route in routes, or to def if none match. If def is nil,
+// unmatched events are discarded.
+func NewRouteHandler(def Handler, routes ...Route) *RouteHandler {
+	return &RouteHandler{
+		routes: append([]Route(nil), routes...),
+		def:    def}
+}
+
+// Route returns the Handler a log event from the named logger at the given
+// level is sent to, or nil if it is discarded.
+func (h *RouteHandler) Route(logger_name string, level LogLevel) Handler {
+	for i := range h.routes {
+		if h.routes[i].matches(logger_name, level) {
+			return h.routes[i].Handler
+		}
+	}
+	return h.def
+}
+
+// Log passes the log event to the matching route's Handler
+func (h *RouteHandler) Log(logger_name string, level LogLevel, msg string,
+	calldepth int) {
+	handler := h.Route(logger_name, level)
+	if handler == nil {
+		return
+	}
+	if calldepth >= 0 {
+		calldepth++
+	}
+	handler.Log(logger_name, level, msg, calldepth)
+}
+
+// LogFields is like Log, but passes fields on to the matching route's Handler
+// if it is a FieldHandler, or formats them onto the message if not.
+func (h *RouteHandler) LogFields(logger_name string, level LogLevel,
+	msg string, calldepth int, fields Fields) {
+	handler := h.Route(logger_name, level)
+	if handler == nil {
+		return
+	}
+	if calldepth >= 0 {
+		calldepth++
+	}
+	logFields(handler, logger_name, level, msg, calldepth, fields)
+}
+
+// SetTextTemplate is a no-op, as each route has its own Handler
+func (h *RouteHandler) SetTextTemplate(t *template.Template) {}
+
+// SetTextOutput is a no-op, as each route has its own Handler
+func (h *RouteHandler) SetTextOutput(output TextOutput) {}
+
+// handlers returns each route's Handler, followed by the default Handler.
+func (h *RouteHandler) handlers() []Handler {
+	handlers := make([]Handler, 0, len(h.routes)+1)
+	for _, route := range h.routes {
+		handlers = append(handlers, route.Handler)
+	}
+	if h.def != nil {
+		handlers = append(handlers, h.def)
+	}
+	return handlers
+}
+
+func (h *RouteHandler) logChildren() []interface{} {
+	handlers := h.handlers()
+	children := make([]interface{}, 0, len(handlers))
+	for _, handler := range handlers {
+		children = append(children, handler)
+	}
+	return children
+}
+
+// Flush flushes each route's Handler and the default Handler, returning the
+// first error encountered
+func (h *RouteHandler) Flush() (err error) {
+	for _, handler := range h.handlers() {
+		if ferr := flushValue(handler); err == nil {
+			err = ferr
+		}
+	}
+	return err
+}
+
+// Close closes each route's Handler and the default Handler, returning the
+// first error encountered
+func (h *RouteHandler) Close() (err error) {
+	for _, handler := range h.handlers() {
+		if cerr := closeValue(handler); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
@@ -22,25 +22,43 @@ import (
 	"os"
 	"os/signal"
 	"regexp"
+	"strconv"
 	"strings"
 	"text/template"
+	"time"
 )
 
 // SetupConfig is a configuration struct meant to be used with
 //   github.com/spacemonkeygo/flagfile/utils.Setup
-// but can be used independently.
+// but can be used independently, or with RegisterFlags.
 type SetupConfig struct {
 	Output   string `default:"stderr" usage:"log output. can be stdout, stderr, syslog, or a path"`
+	Outputs  string `default:"" usage:"a semicolon separated list of outputs to use instead of output, each an output followed by comma separated options: level=<minimum level> and format=<default, color, standard, syslog, stdlib, json or logfmt>. outputs without a format use format. e.g. 'stderr,format=color;/var/log/app.json,format=json,level=info'"`
 	Level    string `default:"" usage:"base logger level"`
 	Filter   string `default:"" usage:"sets loggers matching this regular expression to the lowest level"`
-	Format   string `default:"" usage:"format string to use"`
+	Format   string `default:"" usage:"format string to use, 'json' for one JSON object per line, or 'logfmt' for key=value lines"`
 	Stdlevel string `default:"warn" usage:"logger level for stdlib log integration"`
 	Subproc  string `default:"" usage:"process to run for stdout/stderr-captured logging. The command is first processed as a Go template that supports {{.Facility}}, {{.Level}}, and {{.Name}} fields, and then passed to sh. If set, will redirect stdout and stderr to the given process. A good default is 'setsid logger --priority {{.Facility}}.{{.Level}} --tag {{.Name}}'"`
 	Buffer   int    `default:"0" usage:"the number of messages to buffer. 0 for no buffer"`
 	// Facility defaults to syslog.LOG_USER (which is 8)
 	Facility  int    `default:"8" usage:"the syslog facility to use if syslog output is configured"`
 	HupRotate bool   `default:"false" usage:"if true, sending a HUP signal will reopen log files"`
-	Config    string `default:"" usage:"a semicolon separated list of logger=level; sets each log to the corresponding level"`
+	Config    string `default:"" usage:"a semicolon separated list of logger=level; sets each log to the corresponding level. logger names may be glob patterns such as storage.*"`
+
+	RotateSize      int64  `default:"0" usage:"if logging to a file, rotate it when it grows past this many bytes. 0 disables size-based rotation"`
+	RotateInterval  string `default:"" usage:"if logging to a file, rotate it on this interval. can be hourly, daily, or a duration such as 30m"`
+	RotateKeep      int    `default:"0" usage:"the number of rotated log files to keep. 0 keeps all of them"`
+	RotateTotalSize int64  `default:"0" usage:"the combined size in bytes of all rotated log files to keep, oldest removed first. 0 disables the limit"`
+	RotateMaxAge    string `default:"" usage:"how long to keep rotated log files, as a duration such as 168h. empty keeps them forever"`
+	RotateCompress  bool   `default:"false" usage:"if true, gzip rotated log files in the background"`
+	FileSync        string `default:"never" usage:"when to sync log files to disk: never, always, every-<n> messages, a duration such as 1s, or a level such as error to sync each message at or above it before logging returns (unbuffered only). several may be combined with commas"`
+
+	BufferOverflow     string `default:"block" usage:"what to do with a message when the buffer is full: block, drop-newest, drop-oldest, or drop-below-<level> to drop messages below that level and block for the rest. dropped messages are counted in a line logged every minute"`
+	BufferBatchSize    int    `default:"0" usage:"if buffering, write buffered messages in batches of up to this many bytes. 0 writes them one at a time"`
+	BufferBatchLatency string `default:"" usage:"how long a buffered message may wait for its batch to fill, such as 10ms. empty writes a batch as soon as the buffer is empty"`
+
+	ConfigFile string `default:"" usage:"a .json file, or a .toml file of key = value lines, [tables] and one-line inline tables, of settings that take precedence over these, plus a loggers table of logger=level entries. level, config, filter and format changes in the file are applied when it changes, which is checked periodically and on SIGHUP"`
+	ConfigPoll string `default:"5s" usage:"how often to check the config file for changes. 0 disables polling"`
 }
 
 var (
@@ -76,12 +94,28 @@ type subprocInfo struct {
 //  * capturing stdout and stderr to a subprocess
 //  * configuring the default level
 //  * configuring log filters (enabling only some loggers)
-//  * configuring the logging template
-//  * configuring the output (a file, syslog, stdout, stderr)
+//  * configuring the logging template, or JSON or logfmt output
+//  * configuring the output (a file, syslog, stdout, stderr), or several
+//    outputs, each with its own format and minimum level
+//  * configuring size- and time-based log file rotation, compression and
+//    retention
 //  * configuring log event buffering
 //  * capturing all standard library logging with configurable log level
+//  * reading further configuration from a JSON file or a simple TOML-like
+//    file, and reloading it when it changes
 // It is expected that this method will be called once at process start.
 func Setup(procname string, config SetupConfig) error {
+	base := config
+	var loggers []LevelSpec
+	var config_data []byte
+	if config.ConfigFile != "" {
+		var err error
+		config, loggers, config_data, err = readSetupFile(config.ConfigFile,
+			config)
+		if err != nil {
+			return err
+		}
+	}
 	if config.Subproc != "" {
 		t, err := template.New("subproc").Parse(config.Subproc)
 		if err != nil {
@@ -100,70 +134,170 @@ func Setup(procname string, config SetupConfig) error {
 			return err
 		}
 	}
-	if config.Config != "" {
-		err := ConfigureLoggers(config.Config)
+	err := setupLevels(config, loggers, "Setup", false)
+	if err != nil {
+		return err
+	}
+	_, err = setupTemplate(config.Format)
+	if err != nil {
+		return err
+	}
+	outputs := []*setupOutput{{
+		path:  config.Output,
+		level: LogLevel(math.MinInt32)}}
+	if config.Outputs != "" {
+		outputs, err = parseSetupOutputs(config.Outputs)
 		if err != nil {
 			return err
 		}
 	}
-	if config.Level != "" {
-		level_val, err := LevelFromString(config.Level)
+	for _, output := range outputs {
+		err = output.open(procname, config)
 		if err != nil {
 			return err
 		}
-		if level_val != DefaultLevel {
-			SetLevel(nil, level_val)
-		}
 	}
-	if config.Filter != "" {
-		re, err := regexp.Compile(config.Filter)
+	handler, err := newSetupHandler(outputs, config.Format)
+	if err != nil {
+		return err
+	}
+	stopSetupFileWatcher()
+	SetHandler(nil, handler)
+	if config.ConfigFile != "" {
+		err = watchSetupFile(base, config, config_data, outputs)
 		if err != nil {
 			return err
 		}
-		SetLevel(re, LogLevel(math.MinInt32))
 	}
-	var t *template.Template
-	if config.Format != "" {
-		var err error
-		t, err = template.New("user").Funcs(funcmap).Parse(config.Format)
-		if err != nil {
-			return err
+	log.SetFlags(log.Lshortfile)
+	if config.Stdlevel == "" {
+		config.Stdlevel = "warn"
+	}
+	stdlog_level_val, err := LevelFromString(config.Stdlevel)
+	if err != nil {
+		return err
+	}
+	log.SetOutput(stdlog.WriterWithoutCaller(stdlog_level_val))
+	return nil
+}
+
+// setupOutput is one of the outputs configured by Setup.
+type setupOutput struct {
+	path      string
+	format    string // a name from setupFormats, or empty to use Format
+	level     LogLevel
+	textout   TextOutput
+	default_t *template.Template
+}
+
+// setupFormats are the formats that can be named in an Outputs entry. A nil
+// template means the format isn't a template.
+var setupFormats = map[string]*template.Template{
+	"default":  DefaultTemplate,
+	"color":    ColorTemplate,
+	"standard": StandardTemplate,
+	"syslog":   SyslogTemplate,
+	"stdlib":   StdlibTemplate,
+	"json":     nil,
+	"logfmt":   nil,
+}
+
+// parseSetupOutputs parses an Outputs setting.
+func parseSetupOutputs(spec string) ([]*setupOutput, error) {
+	var outputs []*setupOutput
+	for _, entry := range strings.FieldsFunc(spec, func(r rune) bool {
+		return r == ';' || r == '\n'
+	}) {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.Split(entry, ",")
+		output := &setupOutput{
+			path:  strings.TrimSpace(parts[0]),
+			level: LogLevel(math.MinInt32)}
+		if output.path == "" {
+			return nil, fmt.Errorf("output %q: missing output", entry)
 		}
+		for _, option := range parts[1:] {
+			kv := strings.SplitN(option, "=", 2)
+			if len(kv) != 2 {
+				return nil, fmt.Errorf("output %q: expected option=value, got %q",
+					entry, strings.TrimSpace(option))
+			}
+			key := strings.ToLower(strings.TrimSpace(kv[0]))
+			value := strings.TrimSpace(kv[1])
+			switch key {
+			case "level":
+				var err error
+				output.level, err = LevelFromString(value)
+				if err != nil {
+					return nil, fmt.Errorf("output %q: %s", entry, err)
+				}
+			case "format":
+				output.format = strings.ToLower(value)
+				if _, ok := setupFormats[output.format]; !ok {
+					return nil, fmt.Errorf("output %q: unknown format %q", entry,
+						value)
+				}
+			default:
+				return nil, fmt.Errorf("output %q: unknown option %q", entry,
+					key)
+			}
+		}
+		outputs = append(outputs, output)
+	}
+	if len(outputs) == 0 {
+		return nil, fmt.Errorf("no outputs in %q", spec)
 	}
-	var textout TextOutput
-	switch strings.ToLower(config.Output) {
+	return outputs, nil
+}
+
+// open creates the output's TextOutput, applying the HupRotate, Buffer and
+// rotation settings from config.
+func (o *setupOutput) open(procname string, config SetupConfig) error {
+	switch strings.ToLower(o.path) {
 	case "syslog":
 		w, err := NewSyslogOutput(SyslogPriority(config.Facility), procname)
 		if err != nil {
 			return err
 		}
-		if t == nil {
-			t = SyslogTemplate
-		}
-		textout = w
+		o.default_t = SyslogTemplate
+		o.textout = w
 	case "stdout":
-		if t == nil {
-			t = DefaultTemplate
-		}
-		textout = NewWriterOutput(os.Stdout)
+		o.default_t = DefaultTemplate
+		o.textout = NewWriterOutput(os.Stdout)
 	case "stderr", "":
-		if t == nil {
-			t = DefaultTemplate
-		}
-		textout = NewWriterOutput(os.Stderr)
+		o.default_t = DefaultTemplate
+		o.textout = NewWriterOutput(os.Stderr)
 	default:
-		if t == nil {
-			t = StandardTemplate
-		}
+		o.default_t = StandardTemplate
 		var err error
-		textout, err = NewFileWriterOutput(config.Output)
+		policy, err := parseSyncPolicy(config.FileSync)
 		if err != nil {
 			return err
 		}
+		if config.RotateSize > 0 || config.RotateInterval != "" ||
+			config.RotateKeep > 0 || config.RotateTotalSize > 0 ||
+			config.RotateMaxAge != "" || config.RotateCompress {
+			ro, err := newRotatingSetupOutput(o.path, config)
+			if err != nil {
+				return err
+			}
+			ro.SetSyncPolicy(policy)
+			o.textout = ro
+		} else {
+			fo, err := NewFileWriterOutput(o.path)
+			if err != nil {
+				return err
+			}
+			fo.SetSyncPolicy(policy)
+			o.textout = fo
+		}
 	}
 	if config.HupRotate {
-		if hh, ok := textout.(HupHandlingTextOutput); ok {
-			sigchan := make(chan os.Signal)
+		if hh, ok := o.textout.(HupHandlingTextOutput); ok {
+			sigchan := make(chan os.Signal, 1)
 			signal.Notify(sigchan, sigHUP)
 			go func() {
 				for _ = range sigchan {
@@ -173,17 +307,211 @@ func Setup(procname string, config SetupConfig) error {
 		}
 	}
 	if config.Buffer > 0 {
-		textout = NewBufferedOutput(textout, config.Buffer)
+		opts, err := parseOverflowPolicy(config.BufferOverflow)
+		if err != nil {
+			return err
+		}
+		opts.ReportInterval = time.Minute
+		opts.MaxBatchBytes = config.BufferBatchSize
+		if config.BufferBatchLatency != "" {
+			opts.MaxBatchLatency, err = time.ParseDuration(
+				config.BufferBatchLatency)
+			if err != nil {
+				return err
+			}
+		}
+		o.textout = NewBufferedOutputWithOptions(o.textout, config.Buffer, opts)
 	}
-	SetHandler(nil, NewTextHandler(t, textout))
-	log.SetFlags(log.Lshortfile)
-	if config.Stdlevel == "" {
-		config.Stdlevel = "warn"
+	return nil
+}
+
+// handler returns the Handler for the output, using its own format if it
+// has one, or format, a Format setting, if not.
+func (o *setupOutput) handler(format string) (Handler, error) {
+	if t := setupFormats[o.format]; t != nil {
+		return NewTextHandler(t, o.textout), nil
 	}
-	stdlog_level_val, err := LevelFromString(config.Stdlevel)
+	if o.format != "" {
+		format = o.format
+	}
+	t, err := setupTemplate(format)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	log.SetOutput(stdlog.WriterWithoutCaller(stdlog_level_val))
+	if t == nil {
+		t = o.default_t
+	}
+	return newFormatHandler(format, t, o.textout), nil
+}
+
+// newSetupHandler returns the Handler for outputs. A single output without a
+// level gets its handler directly, and anything else gets a MultiHandler.
+func newSetupHandler(outputs []*setupOutput, format string) (Handler, error) {
+	children := make([]LeveledHandler, 0, len(outputs))
+	for _, output := range outputs {
+		handler, err := output.handler(format)
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, LeveledHandler{
+			Handler: handler,
+			Level:   output.level})
+	}
+	if len(children) == 1 && children[0].Level == LogLevel(math.MinInt32) {
+		return children[0].Handler, nil
+	}
+	return NewMultiHandler(children...), nil
+}
+
+// parseOverflowPolicy parses a BufferOverflow setting.
+func parseOverflowPolicy(policy string) (opts BufferOptions, err error) {
+	policy = strings.ToLower(policy)
+	switch {
+	case policy == "" || policy == "block":
+		opts.Overflow = OverflowBlock
+	case policy == "drop-newest":
+		opts.Overflow = OverflowDropNewest
+	case policy == "drop-oldest":
+		opts.Overflow = OverflowDropOldest
+	case strings.HasPrefix(policy, "drop-below-"):
+		opts.Overflow = OverflowDropBelow
+		opts.DropLevel, err = LevelFromString(
+			strings.TrimPrefix(policy, "drop-below-"))
+		if err != nil {
+			return opts, err
+		}
+	default:
+		return opts, fmt.Errorf("unknown buffer overflow policy %q", policy)
+	}
+	return opts, nil
+}
+
+// parseSyncPolicy parses a FileSync setting.
+func parseSyncPolicy(setting string) (policy SyncPolicy, err error) {
+	for _, part := range strings.Split(setting, ",") {
+		part = strings.ToLower(strings.TrimSpace(part))
+		switch {
+		case part == "" || part == "never":
+		case part == "always":
+			policy.Every = 1
+		case strings.HasPrefix(part, "every-"):
+			policy.Every, err = strconv.Atoi(strings.TrimPrefix(part, "every-"))
+			if err != nil || policy.Every <= 0 {
+				return policy, fmt.Errorf("invalid file sync count %q", part)
+			}
+		case part[0] >= '0' && part[0] <= '9':
+			policy.Interval, err = time.ParseDuration(part)
+			if err != nil {
+				return policy, err
+			}
+		default:
+			policy.Level, err = LevelFromString(part)
+			if err != nil {
+				return policy, fmt.Errorf("invalid file sync setting %q", part)
+			}
+		}
+	}
+	return policy, nil
+}
+
+func newRotatingSetupOutput(path string, config SetupConfig) (
+	*RotatingFileOutput, error) {
+	opts := RotateOptions{
+		MaxSize:      config.RotateSize,
+		MaxBackups:   config.RotateKeep,
+		MaxTotalSize: config.RotateTotalSize,
+		Compress:     config.RotateCompress}
+	if config.RotateMaxAge != "" {
+		var err error
+		opts.MaxAge, err = time.ParseDuration(config.RotateMaxAge)
+		if err != nil {
+			return nil, err
+		}
+	}
+	switch strings.ToLower(config.RotateInterval) {
+	case "":
+	case "hourly":
+		opts.Interval = time.Hour
+	case "daily":
+		opts.Interval = 24 * time.Hour
+	default:
+		var err error
+		opts.Interval, err = time.ParseDuration(config.RotateInterval)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return NewRotatingFileOutput(path, opts)
+}
+
+// setupLevels applies the Level, Config and Filter settings, and then the
+// given logger levels, as a single change. Whichever of those sets the
+// default level is applied first, so that it doesn't discard the others. If
+// reset is true, loggers are reset to the default level first, even if Level
+// is unset.
+func setupLevels(config SetupConfig, loggers []LevelSpec, source string,
+	reset bool) error {
+	var specs []LevelSpec
+	level := DefaultLevel
+	if config.Level != "" {
+		var err error
+		level, err = LevelFromString(config.Level)
+		if err != nil {
+			return err
+		}
+	}
+	if reset || level != DefaultLevel {
+		specs = append(specs, LevelSpec{Name: "DEFAULT", Level: level})
+	}
+	if config.Config != "" {
+		parsed, err := ParseSpecification(config.Config)
+		if err != nil {
+			return err
+		}
+		specs = append(specs, parsed...)
+	}
+	specs = defaultFirst(append(specs, loggers...))
+	var re *regexp.Regexp
+	if config.Filter != "" {
+		var err error
+		re, err = regexp.Compile(config.Filter)
+		if err != nil {
+			return err
+		}
+	}
+	c := DefaultLoggerCollection
+	c.changeLevels(source, func() {
+		c.applyLevelSpecsLocked(specs)
+		if re == nil {
+			return
+		}
+		for name := range c.loggers {
+			if re.MatchString(name) {
+				c.levels[name] = LogLevel(math.MinInt32)
+			}
+		}
+	})
 	return nil
 }
+
+// setupTemplate parses a Format setting. It returns a nil template if the
+// format is empty, json or logfmt.
+func setupTemplate(format string) (*template.Template, error) {
+	switch strings.ToLower(format) {
+	case "", "json", "logfmt":
+		return nil, nil
+	}
+	return template.New("user").Funcs(funcmap).Parse(format)
+}
+
+// newFormatHandler returns the Handler for a Format setting.
+func newFormatHandler(format string, t *template.Template,
+	textout TextOutput) Handler {
+	switch strings.ToLower(format) {
+	case "json":
+		return NewJSONHandler(textout)
+	case "logfmt":
+		return NewLogfmtHandler(textout)
+	}
+	return NewTextHandler(t, textout)
+}
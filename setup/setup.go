@@ -20,11 +20,20 @@ This package adds the following flags:
   --log.level - the base logger level
   --log.filter - loggers that match this regular expression get set to the
       lowest level
-  --log.format - a go text template for log lines
+  --log.format - a go text template for log lines, "json" for JSON lines, or
+      "logfmt" for key=value lines
   --log.stdlevel - the logger level to assume the standard library logger is
       using
   --log.subproc - a process to run for stdout/stderr capturing
   --log.buffer - the number of message to buffer
+
+Each flag can also be set with an environment variable, such as SPACELOG_LEVEL
+or SPACELOG_OUTPUT (see spacelog.SetupConfigFromEnv). Flags given on the
+command line take precedence over the environment.
+
+This package registers its flags with flagfile when it is imported. To register
+them on a flag.FlagSet or pflag.FlagSet of your own instead, use
+spacelog.RegisterFlags and don't import this package.
 */
 package setup
 
@@ -34,11 +43,15 @@ import (
 )
 
 var (
-	config spacelog.SetupConfig
+	config  spacelog.SetupConfig
+	env_err error
 )
 
 func init() {
 	utils.Setup("log", &config)
+	// registering the flags set config to their defaults. replacing those
+	// with the environment now means flags parsed later override it.
+	config, env_err = spacelog.SetupConfigFromEnv(config)
 }
 
 // SetFormatMethod in this subpackage is deprecated and will be removed soon.
@@ -51,13 +64,19 @@ func SetFormatMethod(name string, fn interface{}) {
 // It's pretty useless to call this method without parsing flags first, via
 // flagfile.Load()
 func MustSetup(procname string) {
-	spacelog.MustSetup(procname, config)
+	err := Setup(procname)
+	if err != nil {
+		panic(err)
+	}
 }
 
 // Setup calls spacelog.Setup with a flag-configured config struct
 // It's pretty useless to call this method without parsing flags first, via
 // flagfile.Load()
 func Setup(procname string) error {
+	if env_err != nil {
+		return env_err
+	}
 	return spacelog.Setup(procname, config)
 }
 
@@ -74,6 +93,9 @@ func MustSetupWithFacility(procname string, facility spacelog.SyslogPriority) {
 // configure facility through the facility flag option.
 func SetupWithFacility(procname string,
 	facility spacelog.SyslogPriority) error {
+	if env_err != nil {
+		return env_err
+	}
 	config_copy := config
 	config_copy.Facility = int(facility)
 	return spacelog.Setup(procname, config_copy)
@@ -21,7 +21,8 @@ import (
 )
 
 const (
-	sigHUP = syscallSignal(0x1)
+	sigHUP  = syscallSignal(0x1)
+	sigTERM = syscallSignal(0xf)
 )
 
 type syscallSignal int
@@ -32,6 +33,8 @@ func (s syscallSignal) String() string {
 	switch s {
 	case sigHUP:
 		return "hangup"
+	case sigTERM:
+		return "terminated"
 	}
 	return "signal " + strconv.Itoa(int(s))
 }
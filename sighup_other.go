@@ -19,5 +19,6 @@ package spacelog
 import "syscall"
 
 const (
-	sigHUP = syscall.SIGHUP
+	sigHUP  = syscall.SIGHUP
+	sigTERM = syscall.SIGTERM
 )
@@ -0,0 +1,134 @@
+// Copyright (C) 2017 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spacelog
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// LevelSpec is a single <logger>=<level> entry of a ConfigureLoggers
+// specification. Name may be "DEFAULT" or a glob pattern.
+type LevelSpec struct {
+	Name  string
+	Level LogLevel
+}
+
+// SpecificationError describes a malformed entry in a ConfigureLoggers
+// specification. Line and Column are where the problem was found, starting
+// at 1.
+type SpecificationError struct {
+	Entry  string
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e *SpecificationError) Error() string {
+	return fmt.Sprintf("invalid logger configuration %q at line %d, "+
+		"column %d: %s", e.Entry, e.Line, e.Column, e.Msg)
+}
+
+// ParseSpecification parses a ConfigureLoggers specification without
+// applying it. Entries are of the form <logger>=<level>, separated by
+// semicolons, commas or newlines. Empty entries are ignored, as is
+// everything from a "#" to the end of the line. White space around logger
+// names and levels is ignored, but they may not contain any. If any entry is
+// malformed, a *SpecificationError is returned.
+func ParseSpecification(specification string) ([]LevelSpec, error) {
+	var specs []LevelSpec
+	line, line_start, entry_start := 1, 0, 0
+	comment := false
+	for i := 0; i <= len(specification); i++ {
+		var ch byte = '\n'
+		if i < len(specification) {
+			ch = specification[i]
+		}
+		if ch != '\n' && (comment || (ch != ';' && ch != ',' && ch != '#')) {
+			continue
+		}
+		if !comment {
+			spec, err := parseLevelSpec(specification[entry_start:i],
+				line, entry_start-line_start+1)
+			if err != nil {
+				return nil, err
+			}
+			if spec != nil {
+				specs = append(specs, *spec)
+			}
+		}
+		entry_start = i + 1
+		comment = ch == '#'
+		if ch == '\n' {
+			line, line_start = line+1, i+1
+		}
+	}
+	return specs, nil
+}
+
+// parseLevelSpec parses a single entry, which starts at the given line and
+// column. It returns nil if the entry is empty.
+func parseLevelSpec(entry string, line, column int) (*LevelSpec, error) {
+	trimmed := strings.TrimLeftFunc(entry, unicode.IsSpace)
+	column += len(entry) - len(trimmed)
+	entry = strings.TrimRightFunc(trimmed, unicode.IsSpace)
+	if entry == "" {
+		return nil, nil
+	}
+	fail := func(offset int, msg string) error {
+		return &SpecificationError{Entry: entry, Line: line,
+			Column: column + offset, Msg: msg}
+	}
+	eq := strings.IndexByte(entry, '=')
+	if eq < 0 {
+		return nil, fail(0, "expected <logger>=<level>")
+	}
+	name := strings.TrimRightFunc(entry[:eq], unicode.IsSpace)
+	if name == "" {
+		return nil, fail(0, "missing logger name")
+	}
+	if i := strings.IndexFunc(name, unicode.IsSpace); i >= 0 {
+		return nil, fail(i, "white space in logger name")
+	}
+	levelstr := strings.TrimLeftFunc(entry[eq+1:], unicode.IsSpace)
+	level_offset := len(entry) - len(levelstr)
+	if levelstr == "" {
+		return nil, fail(eq, "missing level")
+	}
+	level, err := LevelFromString(levelstr)
+	if err != nil {
+		return nil, fail(level_offset, err.Error())
+	}
+	return &LevelSpec{Name: name, Level: level}, nil
+}
+
+// defaultFirst returns specs with any DEFAULT entries moved to the front and
+// the rest left in order. Setting the default level discards every other
+// configured level, so specs gathered from several places must set it first.
+func defaultFirst(specs []LevelSpec) []LevelSpec {
+	sorted := make([]LevelSpec, 0, len(specs))
+	for _, spec := range specs {
+		if spec.Name == "DEFAULT" {
+			sorted = append(sorted, spec)
+		}
+	}
+	for _, spec := range specs {
+		if spec.Name != "DEFAULT" {
+			sorted = append(sorted, spec)
+		}
+	}
+	return sorted
+}
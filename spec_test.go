@@ -0,0 +1,151 @@
+// Copyright (C) 2017 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.18
+// +build go1.18
+
+package spacelog
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode"
+)
+
+var specificationSeeds = []string{
+	"",
+	"DEFAULT=ERROR; foo.bar=WARNING",
+	"foo=debug;",
+	"foo=debug;;bar=info",
+	";",
+	"foo:debug",
+	"foo=debug; bar:info",
+	"=x",
+	"foo=",
+	"foo bar=info",
+	"foo=nonsense",
+	"# just a comment",
+	"foo=debug # comment; bar=info",
+	"foo=debug\n# comment\nbar=info\n",
+	"foo=debug,\nbar=info,\r\n  baz = 10",
+	"storage.*=DEBUG, *.rpc=TRACE",
+	"foo=debug\nbar",
+	"DEFAULT=notice\n\n\nfoo.bar==debug",
+	"\xff=debug",
+}
+
+func TestParseSpecification(t *testing.T) {
+	for _, test := range []struct {
+		spec  string
+		specs []LevelSpec
+		err   string
+	}{
+		{spec: "", specs: nil},
+		{spec: "foo=debug;", specs: []LevelSpec{{"foo", Debug}}},
+		{spec: ";", specs: nil},
+		{spec: "foo=debug;;bar=info",
+			specs: []LevelSpec{{"foo", Debug}, {"bar", Info}}},
+		{spec: "foo=debug # comment; bar=info",
+			specs: []LevelSpec{{"foo", Debug}}},
+		{spec: "foo=debug\n# comment\nbar=info\n",
+			specs: []LevelSpec{{"foo", Debug}, {"bar", Info}}},
+		{spec: "foo=debug,\nbar=info,\r\n  baz = 10",
+			specs: []LevelSpec{{"foo", Debug}, {"bar", Info}, {"baz", 10}}},
+		{spec: "storage.*=DEBUG, *.rpc=TRACE",
+			specs: []LevelSpec{{"storage.*", Debug}, {"*.rpc", Trace}}},
+		{spec: "foo:debug", err: `"foo:debug" at line 1, column 1: ` +
+			`expected <logger>=<level>`},
+		{spec: "foo=debug; bar:info", err: `"bar:info" at line 1, column 12`},
+		{spec: "=x", err: `"=x" at line 1, column 1: missing logger name`},
+		{spec: "foo=", err: `"foo=" at line 1, column 4: missing level`},
+		{spec: "foo bar=info", err: `column 4: white space in logger name`},
+		{spec: "foo=debug\n  bar", err: `"bar" at line 2, column 3`},
+		{spec: "a=1\n\nb=nonsense", err: `line 3, column 3: Invalid log level`},
+	} {
+		specs, err := ParseSpecification(test.spec)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("ParseSpecification(%q): got error %v, want %q",
+					test.spec, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseSpecification(%q): %s", test.spec, err)
+			continue
+		}
+		if !reflect.DeepEqual(specs, test.specs) {
+			t.Errorf("ParseSpecification(%q): got %v, want %v",
+				test.spec, specs, test.specs)
+		}
+	}
+}
+
+func FuzzParseSpecification(f *testing.F) {
+	for _, seed := range specificationSeeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, spec string) {
+		specs, err := ParseSpecification(spec)
+		c := NewLoggerCollection()
+		c.GetLoggerNamed("foo.bar")
+		before := c.Specification()
+		configure_err := c.ConfigureLoggers(spec)
+
+		if err != nil {
+			var spec_err *SpecificationError
+			if !errors.As(err, &spec_err) {
+				t.Fatalf("got a %T, not a *SpecificationError: %s", err, err)
+			}
+			if spec_err.Line < 1 || spec_err.Column < 1 {
+				t.Fatalf("bad position in %s", err)
+			}
+			if configure_err == nil {
+				t.Fatalf("ConfigureLoggers accepted %q", spec)
+			}
+			if after := c.Specification(); after != before {
+				t.Fatalf("ConfigureLoggers(%q) failed but changed %q to %q",
+					spec, before, after)
+			}
+			return
+		}
+		if configure_err != nil {
+			t.Fatalf("ConfigureLoggers(%q): %s", spec, configure_err)
+		}
+
+		// every entry should survive being written out and parsed again
+		entries := make([]string, 0, len(specs))
+		for _, s := range specs {
+			if s.Name == "" || strings.IndexFunc(s.Name, unicode.IsSpace) >= 0 ||
+				strings.ContainsAny(s.Name, "=;,#\n") {
+				t.Fatalf("bad logger name %q from %q", s.Name, spec)
+			}
+			entries = append(entries, s.Name+"="+s.Level.specString())
+		}
+		reparsed, err := ParseSpecification(strings.Join(entries, ";"))
+		if err != nil {
+			t.Fatalf("reparsing %q from %q: %s", entries, spec, err)
+		}
+		if len(reparsed) != len(specs) {
+			t.Fatalf("reparsing %q from %q: got %v", entries, spec, reparsed)
+		}
+		for i := range specs {
+			if reparsed[i] != specs[i] {
+				t.Fatalf("reparsing %q from %q: got %v", entries, spec, reparsed)
+			}
+		}
+	})
+}
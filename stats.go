@@ -0,0 +1,255 @@
+// Copyright (C) 2017 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spacelog
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// OutputStats reports what a Handler or TextOutput has written and how it
+// has failed.
+type OutputStats struct {
+	// Bytes and Events count what was written successfully.
+	Bytes  uint64
+	Events uint64
+
+	// Dropped counts events that were thrown away, such as by a full
+	// BufferedOutput or while a file couldn't be opened.
+	Dropped uint64
+
+	// Failovers counts switches by a FailoverOutput from a failing output to
+	// a fallback.
+	Failovers uint64
+
+	// Errors counts failures, such as failed writes, and LastError and
+	// LastErrorTime describe the most recent one.
+	Errors        uint64
+	LastError     error
+	LastErrorTime time.Time
+
+	// LastWriteTime is when something was last written successfully.
+	LastWriteTime time.Time
+}
+
+// Healthy reports whether there have been no errors since the last
+// successful write.
+func (s OutputStats) Healthy() bool {
+	return s.LastError == nil || s.LastWriteTime.After(s.LastErrorTime)
+}
+
+// add adds other to s, keeping the most recent error and write.
+func (s *OutputStats) add(other OutputStats) {
+	s.Bytes += other.Bytes
+	s.Events += other.Events
+	s.Dropped += other.Dropped
+	s.Failovers += other.Failovers
+	s.Errors += other.Errors
+	if other.LastError != nil && other.LastErrorTime.After(s.LastErrorTime) {
+		s.LastError, s.LastErrorTime = other.LastError, other.LastErrorTime
+	}
+	if other.LastWriteTime.After(s.LastWriteTime) {
+		s.LastWriteTime = other.LastWriteTime
+	}
+}
+
+// StatsReporter is an optional interface for Handlers and TextOutputs that
+// keep OutputStats. Each reports only on its own work, so a BufferedOutput
+// counts what it dropped, and the output it wraps counts what it wrote.
+//
+// SetErrorHandler registers fn to be called with each error as it happens.
+// fn must not log to the output that failed. Outputs that would otherwise
+// report errors on stderr stop doing so once they have an error handler.
+type StatsReporter interface {
+	Stats() OutputStats
+	SetErrorHandler(fn func(error))
+}
+
+// outputHealth keeps the OutputStats for a Handler or TextOutput. It
+// implements StatsReporter.
+type outputHealth struct {
+	mtx      sync.Mutex
+	stats    OutputStats
+	on_error func(error)
+}
+
+// Stats returns what has been written and how it has failed
+func (h *outputHealth) Stats() OutputStats {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	return h.stats
+}
+
+// SetErrorHandler registers fn to be called with each error as it happens
+func (h *outputHealth) SetErrorHandler(fn func(error)) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	h.on_error = fn
+}
+
+func (h *outputHealth) wrote(bytes, events int) {
+	h.mtx.Lock()
+	h.stats.Bytes += uint64(bytes)
+	h.stats.Events += uint64(events)
+	h.stats.LastWriteTime = time.Now()
+	h.mtx.Unlock()
+}
+
+func (h *outputHealth) dropped(events int) {
+	h.mtx.Lock()
+	h.stats.Dropped += uint64(events)
+	h.mtx.Unlock()
+}
+
+// failedOver counts a switch to a fallback output and passes err, which
+// describes it, to the error handler. The failure that caused it is counted
+// by the output that failed, so it isn't counted as an error here.
+func (h *outputHealth) failedOver(err error) {
+	h.mtx.Lock()
+	h.stats.Failovers++
+	on_error := h.on_error
+	h.mtx.Unlock()
+	if on_error != nil {
+		on_error(err)
+	}
+}
+
+// failed records err and passes it to the error handler, reporting whether
+// there was one.
+func (h *outputHealth) failed(err error) (handled bool) {
+	h.mtx.Lock()
+	h.stats.Errors++
+	h.stats.LastError = err
+	h.stats.LastErrorTime = time.Now()
+	on_error := h.on_error
+	h.mtx.Unlock()
+	if on_error == nil {
+		return false
+	}
+	on_error(err)
+	return true
+}
+
+// logNode is implemented by Handlers and TextOutputs that pass log events on
+// to others, so LoggerCollection can find every output in use.
+type logNode interface {
+	logChildren() []interface{}
+}
+
+// walkLogNodes calls fn for each distinct Handler and TextOutput reachable
+// from roots.
+func walkLogNodes(roots []Handler, fn func(node interface{})) {
+	seen := make(map[interface{}]bool)
+	var walk func(node interface{})
+	walk = func(node interface{}) {
+		if node == nil {
+			return
+		}
+		if reflect.TypeOf(node).Comparable() {
+			if seen[node] {
+				return
+			}
+			seen[node] = true
+		}
+		fn(node)
+		if parent, ok := node.(logNode); ok {
+			for _, child := range parent.logChildren() {
+				walk(child)
+			}
+		}
+	}
+	for _, root := range roots {
+		walk(root)
+	}
+}
+
+// Stats adds up the OutputStats of every distinct Handler and TextOutput in
+// use by the collection's loggers. LastError is the most recent error from
+// any of them. Bytes and Events only come from the outputs that do the
+// writing, not from those such as BufferedOutput that pass events on to
+// other outputs, so that each event is only counted once.
+func (c *LoggerCollection) Stats() (stats OutputStats) {
+	walkLogNodes(c.handlers(), func(node interface{}) {
+		reporter, ok := node.(StatsReporter)
+		if !ok {
+			return
+		}
+		node_stats := reporter.Stats()
+		if _, ok := node.(logNode); ok {
+			node_stats.Bytes, node_stats.Events = 0, 0
+		}
+		stats.add(node_stats)
+	})
+	return stats
+}
+
+// Health returns nil if every TextOutput in use by the collection's loggers
+// has written successfully since its last error. Otherwise it returns an
+// error describing the most recent failure, such as a full disk.
+func (c *LoggerCollection) Health() error {
+	var unhealthy OutputStats
+	failing := 0
+	walkLogNodes(c.handlers(), func(node interface{}) {
+		reporter, ok := node.(StatsReporter)
+		if !ok {
+			return
+		}
+		if _, ok := node.(TextOutput); !ok {
+			return
+		}
+		stats := reporter.Stats()
+		if !stats.Healthy() {
+			failing++
+			unhealthy.add(stats)
+		}
+	})
+	if failing == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d log outputs failing; last error at %s: %s",
+		failing, unhealthy.LastErrorTime.Format(time.RFC3339),
+		unhealthy.LastError)
+}
+
+// SetErrorHandler registers fn to be called with each error from every
+// Handler and TextOutput in use by the collection's loggers. Handlers and
+// outputs set up later don't get it.
+func (c *LoggerCollection) SetErrorHandler(fn func(error)) {
+	walkLogNodes(c.handlers(), func(node interface{}) {
+		if reporter, ok := node.(StatsReporter); ok {
+			reporter.SetErrorHandler(fn)
+		}
+	})
+}
+
+// Stats adds up the OutputStats of everything in use by the default
+// collection.
+func Stats() OutputStats {
+	return DefaultLoggerCollection.Stats()
+}
+
+// Health returns nil if every output in use by the default collection has
+// written successfully since its last error.
+func Health() error {
+	return DefaultLoggerCollection.Health()
+}
+
+// SetErrorHandler registers fn to be called with each error from everything
+// in use by the default collection.
+func SetErrorHandler(fn func(error)) {
+	DefaultLoggerCollection.SetErrorHandler(fn)
+}
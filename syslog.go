@@ -25,7 +25,8 @@ type SyslogPriority syslog.Priority
 
 // SyslogOutput is a syslog client that matches the TextOutput interface
 type SyslogOutput struct {
-	w *syslog.Writer
+	w      *syslog.Writer
+	health outputHealth
 }
 
 // NewSyslogOutput returns a TextOutput object that writes to syslog using
@@ -43,23 +44,46 @@ func NewSyslogOutput(facility SyslogPriority, tag string) (
 func (o *SyslogOutput) Output(level LogLevel, message []byte) {
 	level = level.Match()
 	for _, msg := range bytes.Split(message, []byte{'\n'}) {
+		var err error
 		switch level {
 		case Critical:
-			o.w.Crit(string(msg))
+			err = o.w.Crit(string(msg))
 		case Error:
-			o.w.Err(string(msg))
+			err = o.w.Err(string(msg))
 		case Warning:
-			o.w.Warning(string(msg))
+			err = o.w.Warning(string(msg))
 		case Notice:
-			o.w.Notice(string(msg))
+			err = o.w.Notice(string(msg))
 		case Info:
-			o.w.Info(string(msg))
+			err = o.w.Info(string(msg))
 		case Debug:
 			fallthrough
 		case Trace:
 			fallthrough
 		default:
-			o.w.Debug(string(msg))
+			err = o.w.Debug(string(msg))
+		}
+		if err != nil {
+			o.health.failed(err)
+			o.health.dropped(1)
+			return
 		}
 	}
+	o.health.wrote(len(message), 1)
+}
+
+// Stats returns what has been sent to syslog and how sending has failed
+func (o *SyslogOutput) Stats() OutputStats {
+	return o.health.Stats()
+}
+
+// SetErrorHandler registers fn to be called with each error sending to syslog
+func (o *SyslogOutput) SetErrorHandler(fn func(error)) {
+	o.health.SetErrorHandler(fn)
+}
+
+// Close closes the connection to the syslog daemon. A later write opens it
+// again.
+func (o *SyslogOutput) Close() error {
+	return o.w.Close()
 }
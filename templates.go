@@ -44,26 +44,27 @@ var (
 			`{{.Bold}}{{ColorizeLevel .Level}}{{.LevelJustified}}{{.Reset}} ` +
 			`{{.Underline}}{{.LoggerName}}{{.Reset}} ` +
 			`{{if .Filename}}{{.Filename}}:{{.Line}} {{end}}- ` +
-			`{{ColorizeLevel .Level}}{{.Message}}{{.Reset}}`))
+			`{{ColorizeLevel .Level}}{{.Message}}{{.Reset}}` +
+			`{{with .Fields}} {{.}}{{end}}`))
 
 	// StandardTemplate is like ColorTemplate with no color.
 	StandardTemplate = template.Must(template.New("standard").Parse(
 		`{{.Date}} {{.Time}} ` +
 			`{{.Level}} {{.LoggerName}} ` +
 			`{{if .Filename}}{{.Filename}}:{{.Line}} {{end}}` +
-			`- {{.Message}}`))
+			`- {{.Message}}{{with .Fields}} {{.}}{{end}}`))
 
 	// SyslogTemplate is missing the date and time as syslog adds those
 	// things.
 	SyslogTemplate = template.Must(template.New("syslog").Parse(
 		`{{.Level}} {{.LoggerName}} ` +
 			`{{if .Filename}}{{.Filename}}:{{.Line}} {{end}}` +
-			`- {{.Message}}`))
+			`- {{.Message}}{{with .Fields}} {{.}}{{end}}`))
 
 	// StdlibTemplate is missing the date and time as the stdlib logger often
 	// adds those things.
 	StdlibTemplate = template.Must(template.New("stdlib").Parse(
 		`{{.Level}} {{.LoggerName}} ` +
 			`{{if .Filename}}{{.Filename}}:{{.Line}} {{end}}` +
-			`- {{.Message}}`))
+			`- {{.Message}}{{with .Fields}} {{.}}{{end}}`))
 )
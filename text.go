@@ -32,6 +32,7 @@ type TextHandler struct {
 	mtx      sync.RWMutex
 	template *template.Template
 	output   TextOutput
+	health   outputHealth
 }
 
 // NewTextHandler creates a Handler that creates LogEvents, passes them to
@@ -44,6 +45,16 @@ func NewTextHandler(t *template.Template, output TextOutput) *TextHandler {
 // the output to configured output sink
 func (h *TextHandler) Log(logger_name string, level LogLevel, msg string,
 	calldepth int) {
+	if calldepth >= 0 {
+		calldepth++
+	}
+	h.LogFields(logger_name, level, msg, calldepth, nil)
+}
+
+// LogFields is like Log, but also makes the given fields available to the
+// template as the LogEvent's Fields.
+func (h *TextHandler) LogFields(logger_name string, level LogLevel,
+	msg string, calldepth int, fields Fields) {
 	h.mtx.RLock()
 	output, template := h.output, h.template
 	h.mtx.RUnlock()
@@ -51,13 +62,15 @@ func (h *TextHandler) Log(logger_name string, level LogLevel, msg string,
 		LoggerName: logger_name,
 		Level:      level,
 		Message:    strings.TrimRight(msg, "\n\r"),
-		Timestamp:  time.Now()}
+		Timestamp:  time.Now(),
+		Fields:     fields}
 	if calldepth >= 0 {
 		_, event.Filepath, event.Line, _ = runtime.Caller(calldepth + 1)
 	}
 	var buf bytes.Buffer
 	err := template.Execute(&buf, &event)
 	if err != nil {
+		h.health.failed(err)
 		output.Output(level, []byte(
 			fmt.Sprintf("log format template failed: %s", err)))
 		return
@@ -78,3 +91,36 @@ func (h *TextHandler) SetTextOutput(output TextOutput) {
 	defer h.mtx.Unlock()
 	h.output = output
 }
+
+// Stats reports the TextHandler's formatting errors. What its TextOutput
+// sink writes is in the sink's own Stats.
+func (h *TextHandler) Stats() OutputStats {
+	return h.health.Stats()
+}
+
+// SetErrorHandler registers fn to be called with each formatting error
+func (h *TextHandler) SetErrorHandler(fn func(error)) {
+	h.health.SetErrorHandler(fn)
+}
+
+func (h *TextHandler) logChildren() []interface{} {
+	h.mtx.RLock()
+	defer h.mtx.RUnlock()
+	return []interface{}{h.output}
+}
+
+// Flush flushes the TextHandler's TextOutput sink
+func (h *TextHandler) Flush() error {
+	h.mtx.RLock()
+	output := h.output
+	h.mtx.RUnlock()
+	return flushValue(output)
+}
+
+// Close flushes and closes the TextHandler's TextOutput sink
+func (h *TextHandler) Close() error {
+	h.mtx.RLock()
+	output := h.output
+	h.mtx.RUnlock()
+	return closeValue(output)
+}